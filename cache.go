@@ -0,0 +1,327 @@
+package cdb
+
+import (
+	"container/list"
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// EvictionPolicy tells BlockCache which block should be dropped when the cache is full.
+type EvictionPolicy int
+
+const (
+	// LRU evicts the least recently used block
+	LRU EvictionPolicy = iota
+	// CLOCK evicts the first block that was not used since the last sweep of the clock hand.
+	// It is cheaper than LRU on hits and is not flushed by a single iteration over the database.
+	CLOCK
+)
+
+// Default size of a block of BlockCache
+const defaultBlockSize = 4096
+
+// lastCacheOwner is used to generate unique owners of cached blocks
+var lastCacheOwner uint64
+
+// CacheStats contains counters of a cache
+type CacheStats struct {
+	Hits, Misses uint64
+}
+
+// BlockCache keeps fixed-size blocks of the underlying io.ReaderAt in memory, so hash table slots
+// and records that are used often do not cost a syscall (or a network request) per lookup.
+// A BlockCache can be shared between several readers, it is safe for concurrent use.
+type BlockCache struct {
+	blockSize int64
+	capacity  int
+
+	mu    sync.Mutex
+	store blockStore
+	stats CacheStats
+}
+
+// blockKey identifies a cached block
+type blockKey struct {
+	owner uint64
+	index int64
+}
+
+// blockStore is an eviction strategy of BlockCache
+type blockStore interface {
+	get(key blockKey) ([]byte, bool)
+	put(key blockKey, data []byte)
+	contains(key blockKey) bool
+}
+
+// NewBlockCache returns a new instance of BlockCache which keeps up to size bytes in blocks of blockSize bytes.
+// If blockSize is not positive, 4096 is used.
+func NewBlockCache(size, blockSize int, policy EvictionPolicy) *BlockCache {
+	if blockSize <= 0 {
+		blockSize = defaultBlockSize
+	}
+
+	capacity := size / blockSize
+	if capacity < 1 {
+		capacity = 1
+	}
+
+	var store blockStore
+
+	switch policy {
+	case CLOCK:
+		store = newClockStore(capacity)
+	default:
+		store = newLRUStore(capacity)
+	}
+
+	return &BlockCache{
+		blockSize: int64(blockSize),
+		capacity:  capacity,
+		store:     store,
+	}
+}
+
+// Stats returns hit/miss counters of the cache
+func (c *BlockCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.stats
+}
+
+// newCacheOwner returns a new unique identifier of a cached reader
+func newCacheOwner() uint64 {
+	return atomic.AddUint64(&lastCacheOwner, 1)
+}
+
+// readAt reads len(p) bytes starting from off through the cache.
+// Missed blocks that follow each other are read from the given reader at once.
+func (c *BlockCache) readAt(reader io.ReaderAt, owner uint64, p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	first, last := off/c.blockSize, (off+int64(len(p))-1)/c.blockSize
+
+	if int(last-first) >= c.capacity {
+		return reader.ReadAt(p, off)
+	}
+
+	n := 0
+
+	for index := first; index <= last && n < len(p); index++ {
+		data, err := c.block(reader, owner, index, last)
+		if err != nil {
+			return n, err
+		}
+
+		start := off + int64(n) - index*c.blockSize
+		if start >= int64(len(data)) {
+			return n, io.EOF
+		}
+
+		n += copy(p[n:], data[start:])
+
+		if int64(len(data)) < c.blockSize && n < len(p) {
+			return n, io.EOF
+		}
+	}
+
+	return n, nil
+}
+
+// block returns the block with the given index, reading it (and missed blocks up to the last one) on a miss
+func (c *BlockCache) block(reader io.ReaderAt, owner uint64, index, last int64) ([]byte, error) {
+	key := blockKey{owner, index}
+
+	c.mu.Lock()
+	if data, ok := c.store.get(key); ok {
+		c.stats.Hits++
+		c.mu.Unlock()
+
+		return data, nil
+	}
+
+	c.stats.Misses++
+
+	end := index
+	for end < last && !c.store.contains(blockKey{owner, end + 1}) {
+		end++
+	}
+	c.mu.Unlock()
+
+	buf := make([]byte, (end-index+1)*c.blockSize)
+	n, err := reader.ReadAt(buf, index*c.blockSize)
+
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	buf = buf[:n]
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i := index; i <= end; i++ {
+		start := (i - index) * c.blockSize
+		if start > int64(len(buf)) {
+			break
+		}
+
+		stop := start + c.blockSize
+		if stop > int64(len(buf)) {
+			stop = int64(len(buf))
+		}
+
+		c.store.put(blockKey{owner, i}, buf[start:stop:stop])
+	}
+
+	if int64(len(buf)) > c.blockSize {
+		return buf[:c.blockSize], nil
+	}
+
+	return buf, nil
+}
+
+// cachedReaderAt implements ReaderAtContext, it reads the underlying reader through BlockCache
+type cachedReaderAt struct {
+	reader io.ReaderAt
+	cache  *BlockCache
+	owner  uint64
+}
+
+// newCachedReaderAt returns a new instance of cachedReaderAt
+func newCachedReaderAt(reader io.ReaderAt, cache *BlockCache) *cachedReaderAt {
+	return &cachedReaderAt{
+		reader: reader,
+		cache:  cache,
+		owner:  newCacheOwner(),
+	}
+}
+
+// ReadAt implements io.ReaderAt interface
+func (c *cachedReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	return c.cache.readAt(c.reader, c.owner, p, off)
+}
+
+// ReadAtContext implements ReaderAtContext interface
+func (c *cachedReaderAt) ReadAtContext(ctx context.Context, p []byte, off int64) (int, error) {
+	return c.cache.readAt(&contextReaderAt{ctx: ctx, reader: c.reader}, c.owner, p, off)
+}
+
+// lruStore implements blockStore with LRU eviction
+type lruStore struct {
+	capacity int
+	items    map[blockKey]*list.Element
+	order    *list.List
+}
+
+// lruItem is an element of lruStore.order
+type lruItem struct {
+	key  blockKey
+	data []byte
+}
+
+// newLRUStore returns a new instance of lruStore
+func newLRUStore(capacity int) *lruStore {
+	return &lruStore{
+		capacity: capacity,
+		items:    make(map[blockKey]*list.Element, capacity),
+		order:    list.New(),
+	}
+}
+
+func (s *lruStore) get(key blockKey) ([]byte, bool) {
+	elem, ok := s.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	s.order.MoveToFront(elem)
+
+	return elem.Value.(*lruItem).data, true
+}
+
+func (s *lruStore) contains(key blockKey) bool {
+	_, ok := s.items[key]
+	return ok
+}
+
+func (s *lruStore) put(key blockKey, data []byte) {
+	if elem, ok := s.items[key]; ok {
+		s.order.MoveToFront(elem)
+		return
+	}
+
+	s.items[key] = s.order.PushFront(&lruItem{key: key, data: data})
+
+	for s.order.Len() > s.capacity {
+		elem := s.order.Back()
+		s.order.Remove(elem)
+		delete(s.items, elem.Value.(*lruItem).key)
+	}
+}
+
+// clockStore implements blockStore with CLOCK (second chance) eviction
+type clockStore struct {
+	keys       []blockKey
+	data       [][]byte
+	referenced []bool
+	items      map[blockKey]int
+	hand       int
+}
+
+// newClockStore returns a new instance of clockStore
+func newClockStore(capacity int) *clockStore {
+	return &clockStore{
+		keys:       make([]blockKey, 0, capacity),
+		data:       make([][]byte, 0, capacity),
+		referenced: make([]bool, 0, capacity),
+		items:      make(map[blockKey]int, capacity),
+	}
+}
+
+func (s *clockStore) get(key blockKey) ([]byte, bool) {
+	i, ok := s.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	s.referenced[i] = true
+
+	return s.data[i], true
+}
+
+func (s *clockStore) contains(key blockKey) bool {
+	_, ok := s.items[key]
+	return ok
+}
+
+func (s *clockStore) put(key blockKey, data []byte) {
+	if _, ok := s.items[key]; ok {
+		return
+	}
+
+	if len(s.keys) < cap(s.keys) {
+		s.items[key] = len(s.keys)
+		s.keys = append(s.keys, key)
+		s.data = append(s.data, data)
+		s.referenced = append(s.referenced, false)
+
+		return
+	}
+
+	for s.referenced[s.hand] {
+		s.referenced[s.hand] = false
+		s.hand = (s.hand + 1) % len(s.keys)
+	}
+
+	delete(s.items, s.keys[s.hand])
+
+	s.items[key] = s.hand
+	s.keys[s.hand] = key
+	s.data[s.hand] = data
+	s.hand = (s.hand + 1) % len(s.keys)
+}
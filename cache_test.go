@@ -0,0 +1,103 @@
+package cdb
+
+import (
+	"os"
+	"strconv"
+	"testing"
+)
+
+func (suite *CDBTestSuite) TestBlockCacheLRU() {
+	cache := NewBlockCache(64*1024, 512, LRU)
+	suite.cdbHandle.SetBlockCache(cache)
+
+	suite.fillTestCDB()
+	reader := suite.getCDBReader()
+
+	var misses uint64
+
+	for i := 0; i < 2; i++ {
+		for _, rec := range suite.testRecords {
+			value, err := reader.Get(rec.key)
+			suite.Nil(err)
+			suite.Equal(rec.val, value)
+		}
+
+		if i == 0 {
+			misses = cache.Stats().Misses
+		}
+	}
+
+	stats := cache.Stats()
+
+	suite.NotZero(stats.Hits)
+	suite.Equal(misses, stats.Misses, "all blocks should be cached after the first pass")
+}
+
+func (suite *CDBTestSuite) TestBlockCacheCLOCK() {
+	cache := NewBlockCache(1024, 256, CLOCK)
+	suite.cdbHandle.SetBlockCache(cache)
+
+	suite.TestShouldReturnAllValues()
+	suite.TestConcurrentGet()
+	suite.TestIterator()
+
+	suite.NotZero(cache.Stats().Hits)
+}
+
+func (suite *CDBTestSuite) TestBlockCacheConcurrentGet() {
+	suite.cdbHandle.SetBlockCache(NewBlockCache(512, 64, LRU))
+	suite.TestConcurrentGet()
+}
+
+func TestLRUStoreEviction(t *testing.T) {
+	store := newLRUStore(2)
+
+	store.put(blockKey{index: 1}, []byte{1})
+	store.put(blockKey{index: 2}, []byte{2})
+	store.get(blockKey{index: 1})
+	store.put(blockKey{index: 3}, []byte{3})
+
+	if !store.contains(blockKey{index: 1}) || store.contains(blockKey{index: 2}) || !store.contains(blockKey{index: 3}) {
+		t.Errorf("the least recently used block should be evicted")
+	}
+}
+
+func TestClockStoreEviction(t *testing.T) {
+	store := newClockStore(2)
+
+	store.put(blockKey{index: 1}, []byte{1})
+	store.put(blockKey{index: 2}, []byte{2})
+	store.get(blockKey{index: 1})
+	store.put(blockKey{index: 3}, []byte{3})
+
+	if !store.contains(blockKey{index: 1}) || store.contains(blockKey{index: 2}) || !store.contains(blockKey{index: 3}) {
+		t.Errorf("the referenced block should get a second chance")
+	}
+}
+
+func BenchmarkReaderGetWithBlockCache(b *testing.B) {
+
+	n := 1000
+	f, _ := os.Create("test.cdb")
+	defer f.Close()
+	defer os.Remove("test.cdb")
+
+	handle := New()
+	writer, _ := handle.GetWriter(f)
+
+	keys := make([][]byte, n)
+	for i := 0; i < n; i++ {
+		keys[i] = []byte(strconv.Itoa(i))
+		writer.Put(keys[i], keys[i])
+	}
+
+	writer.Close()
+	handle.SetBlockCache(NewBlockCache(1<<20, 0, CLOCK))
+	reader, _ := handle.GetReader(f)
+
+	b.ResetTimer()
+	for j := 0; j < b.N; j++ {
+		reader.Get(keys[j%n])
+	}
+
+}
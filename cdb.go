@@ -3,9 +3,14 @@
 package cdb
 
 import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
 	"errors"
 	"hash"
 	"io"
+	"iter"
+	"time"
 )
 
 const (
@@ -22,20 +27,63 @@ const (
 // ErrOutOfMemory tells that it was an attempt to create a cdb database up to 4 gigabytes
 var ErrOutOfMemory = errors.New("OutOfMemory. CDB can handle any database up to 4 gigabytes")
 
+// ErrWriterClosed tells that a database has already been committed
+var ErrWriterClosed = errors.New("cdb writer is closed")
+
+// ErrValueSize tells that a reader given to Writer.PutReader has less bytes than declared
+var ErrValueSize = errors.New("value size differs from the declared size")
+
 // Hasher is a callback for creating a new instance of hash.Hash32.
 type Hasher func() hash.Hash32
 
 // CDB is an associative array: it maps strings (``keys'') to strings (``data'').
 type CDB struct {
 	Hasher
+	blockCache *BlockCache
+	valueCache *ValueCache
+	// filterBitsPerKey is the size of the filter of keys, 0 disables the filter
+	filterBitsPerKey int
+	// withFingerprints enables fingerprints of hash table slots
+	withFingerprints bool
+	// withIndex enables the sorted key index
+	withIndex bool
+	// tempDir is a directory for temporary files of writers
+	tempDir string
+	// memoryLimit is the max size of slot lists kept in memory by writers, 0 means unlimited
+	memoryLimit int
+	// duplicates tells writers what to do with keys that have already been put
+	duplicates DuplicateMode
+	// order is the order of records in new databases, nil means the order of Put calls
+	order Comparator
+	// progress is a callback for reporting the progress of writers
+	progress         ProgressFunc
+	progressInterval time.Duration
+	// encryption encrypts records of new databases and decrypts records of read ones, nil means no encryption
+	encryption *EncryptionOptions
+	// signingKey signs new databases, trustedKeys are keys of signatures of read databases
+	signingKey  ed25519.PrivateKey
+	trustedKeys []ed25519.PublicKey
 }
 
 // Writer provides API for creating database.
+// A failure (except ErrDuplicateKey and ErrOutOfMemory) is sticky: all further calls return the same error,
+// and Close does not write the header, so an incomplete database can not be taken for a valid one.
 type Writer interface {
 	// Put saves a new associated pair <key, value> into databases. Returns an error on failure.
 	Put(key []byte, value []byte) error
+	// PutReader saves a new pair <key, value>, where exactly size bytes of the value are copied from the given reader.
+	// It allows to store large values without holding them in memory, the rest of the reader is not read.
+	// If the reader has less bytes than declared, ErrValueSize is returned and the writer can not be used anymore.
+	PutReader(key []byte, value io.Reader, size uint32) error
 	// Close commits database, makes it possible for reading.
 	Close() error
+	// CloseWithSummary is like Close, but also returns the summary of the committed database.
+	CloseWithSummary() (BuildSummary, error)
+	// Stats returns the progress of building the database.
+	Stats() WriterStats
+	// EstimatedSize returns the size of the database (records and hash tables) if it was closed now.
+	// Put fails with ErrOutOfMemory, leaving the writer usable, if the database would become too large.
+	EstimatedSize() int64
 }
 
 // Reader provides API for retrieving values, iterating through dataset. All methods are thread safe.
@@ -50,6 +98,42 @@ type Reader interface {
 	IteratorAt(key []byte) (Iterator, error)
 	// Size returns the size of the dataset
 	Size() int
+	// GetContext is like Get, but aborts reading as soon as ctx is done.
+	GetContext(ctx context.Context, key []byte) ([]byte, error)
+	// HasContext is like Has, but aborts reading as soon as ctx is done.
+	HasContext(ctx context.Context, key []byte) (bool, error)
+	// IteratorContext is like Iterator, but the returned Iterator passes ctx to every read it issues.
+	IteratorContext(ctx context.Context) (Iterator, error)
+	// Scan returns a new Iterator object that yields records with keys in [start, end) in lexicographic order.
+	// Nil start or end means there is no bound. Returns nil if there are no such keys,
+	// ErrNoIndex if the database was built without the key index.
+	Scan(start, end []byte) (Iterator, error)
+	// Prefix returns a new Iterator object that yields records which keys start with the given prefix
+	// in lexicographic order. Returns nil if there are no such keys, ErrNoIndex if there is no key index.
+	Prefix(prefix []byte) (Iterator, error)
+	// All returns a sequence of all records in file order for range loops. A read error stops the loop,
+	// Err returns it. Records superseded with ReplaceDuplicates are yielded as well.
+	All() iter.Seq2[[]byte, []byte]
+	// Keys is like All, but yields only keys.
+	Keys() iter.Seq[[]byte]
+	// ValuesFor returns a sequence of all values associated with the given key in the order of Put calls.
+	// A read error stops the loop, Err returns it.
+	ValuesFor(key []byte) iter.Seq[[]byte]
+	// Err returns the first error which stopped a sequence of All, Keys or ValuesFor, nil if there was none.
+	// The error is kept, so a reader which failed to read its file should be reopened.
+	Err() error
+	// Codecs returns names of codecs of keys and values recorded by TypedWriter (see NamedCodec),
+	// empty if unknown.
+	Codecs() (key, value string)
+}
+
+// ReaderAtContext can be implemented by a storage backend (network filesystem, object store, etc)
+// in order to make reads cancellable. If the io.ReaderAt given to GetReader implements this interface,
+// the context of *Context methods is propagated to each read.
+type ReaderAtContext interface {
+	io.ReaderAt
+	// ReadAtContext is like ReadAt, but should return ctx.Err() as soon as ctx is done.
+	ReadAtContext(ctx context.Context, p []byte, off int64) (int, error)
 }
 
 // Iterator provides API for iterating through database's records. Do not share object between multiple goroutines.
@@ -80,7 +164,7 @@ type Record interface {
 
 // New returns a new instance of CDB struct.
 func New() *CDB {
-	return &CDB{NewHash}
+	return &CDB{Hasher: NewHash}
 }
 
 // SetHash tells the cdb to use the given hash function for calculations.
@@ -94,12 +178,203 @@ func (cdb *CDB) SetHash(hasher Hasher) {
 	cdb.Hasher = hasher
 }
 
+// SetBlockCache tells the cdb to read databases through the given cache.
+// Given cache will be used only for new instances of Reader, nil disables caching.
+// The same cache can be shared between several readers.
+func (cdb *CDB) SetBlockCache(cache *BlockCache) {
+	cdb.blockCache = cache
+}
+
+// SetValueCache tells the cdb to cache values (and misses) returned by Reader.Get, Reader.Has in the given cache.
+// Given cache will be used only for new instances of Reader, nil disables caching.
+func (cdb *CDB) SetValueCache(cache *ValueCache) {
+	cdb.valueCache = cache
+}
+
+// SetFilter tells the cdb to build a Bloom filter of keys with the given number of bits per key
+// (10 bits give about 1% of false positives). The filter is stored in the database after the hash tables,
+// it is loaded into memory by Reader, so most of lookups of absent keys do not touch the disk.
+// Databases with a filter are still readable by any cdb reader. Zero disables the filter.
+// Given value will be used only for new instances of Writer.
+func (cdb *CDB) SetFilter(bitsPerKey int) {
+	cdb.filterBitsPerKey = bitsPerKey
+}
+
+// SetFingerprints tells the cdb to store an additional 32-bit fingerprint (a hash independent of Hasher)
+// for each hash table slot. When the slot hash of a looked up key matches, Reader compares fingerprints
+// before reading the record, so hash collisions rarely cost a record read.
+// Fingerprints are stored after the hash tables, so the database is still readable by any cdb reader.
+// Given value will be used only for new instances of Writer.
+func (cdb *CDB) SetFingerprints(enabled bool) {
+	cdb.withFingerprints = enabled
+}
+
+// SetIndex tells the cdb to store positions of records sorted by key (4 bytes per record),
+// so Reader.Scan and Reader.Prefix can iterate over ranges of keys in lexicographic order.
+// The index is stored after the hash tables, so the database is still readable by any cdb reader.
+// Given value will be used only for new instances of Writer.
+func (cdb *CDB) SetIndex(enabled bool) {
+	cdb.withIndex = enabled
+}
+
 // GetWriter returns a new Writer object.
 func (cdb *CDB) GetWriter(writer io.WriteSeeker) (Writer, error) {
-	return newWriter(writer, cdb.Hasher)
+	w, err := cdb.getWriter(writer)
+	if err != nil {
+		return nil, err
+	}
+
+	if cdb.order != nil {
+		return w.wrap(newParallelWriter(w, 1, cdb.tempDir, byKeySeq(cdb.order))), nil
+	}
+
+	return w.wrap(w), nil
+}
+
+// getWriter returns a new writerImpl configured with the cdb settings
+func (cdb *CDB) getWriter(writer io.WriteSeeker) (*writerImpl, error) {
+	if _, ok := writer.(io.ReaderAt); !ok && (cdb.duplicates != AllowDuplicates || cdb.signingKey != nil) {
+		return nil, ErrWriterNotReadable
+	}
+
+	var (
+		e   *encryption
+		err error
+	)
+
+	if options := cdb.encryption; options != nil {
+		if e, err = newDatabaseEncryption(options); err != nil {
+			return nil, err
+		}
+	}
+
+	w, err := newWriter(writer, cdb.Hasher)
+	if err != nil {
+		return nil, err
+	}
+
+	w.filterBitsPerKey = cdb.filterBitsPerKey
+	w.withFingerprints = cdb.withFingerprints
+	w.memoryLimit = cdb.memoryLimit
+	w.tempDir = cdb.tempDir
+	w.duplicates = cdb.duplicates
+	w.encryption = e
+	w.signingKey = cdb.signingKey
+
+	if cdb.withIndex {
+		w.index = newRecordSorter(byKeySeq(bytes.Compare), defaultRunSize, 1, cdb.tempDir)
+	}
+	w.progress = progress{fn: cdb.progress, interval: cdb.progressInterval}
+
+	return w, nil
+}
+
+// SetTempDir tells the cdb where writers should keep their temporary files, the default is os.TempDir.
+// Given value will be used only for new instances of Writer.
+func (cdb *CDB) SetTempDir(dir string) {
+	cdb.tempDir = dir
+}
+
+// SetMemoryLimit limits memory taken by hash table slots (8 bytes per record, 4 more with fingerprints
+// and 8 more with a filter of keys) while a database is being built. When the limit is exceeded, slots
+// and key hashes are moved to a temporary file and are read back one table at a time on Close, the fingerprint
+// section is moved there as well while the hash tables are written. The filter itself is kept in memory.
+// Zero means no limit.
+// Given value will be used only for new instances of Writer.
+func (cdb *CDB) SetMemoryLimit(bytes int) {
+	cdb.memoryLimit = bytes
+}
+
+// SetDuplicates tells the cdb what writers should do with a key that has already been put.
+// RejectDuplicates and ReplaceDuplicates modes keep a map of key hashes to hash table slots in memory
+// (about 50 bytes per key, not limited by SetMemoryLimit, keys themselves are not kept) and compare keys
+// of records with equal hashes by reading them back, so the io.WriteSeeker given to GetWriter must implement
+// io.ReaderAt (like *os.File).
+// Parallel and sorted writers (see SetOrder) apply the mode on Close in the order of Put calls,
+// so records of equal keys are not ordered by value then. In RejectDuplicates mode their Close fails
+// with an error which wraps ErrDuplicateKey and names the key, and the database is not committed.
+// Given value will be used only for new instances of Writer.
+func (cdb *CDB) SetDuplicates(mode DuplicateMode) {
+	cdb.duplicates = mode
+}
+
+// SetProgress tells the cdb to report the progress of building a database to the given callback,
+// which is called from Put at most once per interval. nil disables reporting.
+// Given value will be used only for new instances of Writer.
+func (cdb *CDB) SetProgress(interval time.Duration, fn ProgressFunc) {
+	cdb.progressInterval, cdb.progress = interval, fn
+}
+
+// SetOrder tells the cdb that writers should lay out records ordered by key using the given comparator,
+// e.g. bytes.Compare, instead of the order of Put calls. Records are buffered (and spilled to temporary files
+// if necessary) until Close, then they are written in sorted order, so Iterator yields keys in that order
+// and nearby keys share disk pages. Records of equal keys keep the order of Put calls. Nil turns sorting off.
+//
+// GetWriter returns a buffering writer then, like GetParallelWriter with a single goroutine: nothing is written
+// to the file before Close, PutReader reads every value into memory instead of streaming it, and Stats().Offset
+// is the position the next record would have in the file, not the current position.
+// Given value will be used only for new instances of Writer.
+func (cdb *CDB) SetOrder(cmp Comparator) {
+	cdb.order = cmp
+}
+
+// GetParallelWriter returns a new Writer object, which Put method can be called from multiple goroutines.
+// Records are buffered (and spilled to temporary files if necessary) until Close, then they are written
+// ordered by key (by value for equal keys), so the database does not depend on the order of Put calls.
+// With RejectDuplicates or ReplaceDuplicates (see SetDuplicates) records of equal keys are ordered
+// by Put calls instead: the last put record of a key wins, or Close fails on a duplicate key.
+// Keys are compared by the comparator given to SetOrder, bytes.Compare by default.
+// Hash tables are built by the given number of goroutines, zero means runtime.NumCPU().
+func (cdb *CDB) GetParallelWriter(writer io.WriteSeeker, workers int) (Writer, error) {
+	w, err := cdb.getWriter(writer)
+	if err != nil {
+		return nil, err
+	}
+
+	order := cdb.order
+	if order == nil {
+		order = bytes.Compare
+	}
+
+	less := byKeyThenValue(order)
+	if cdb.duplicates != AllowDuplicates {
+		less = byKeySeq(order)
+	}
+
+	return w.wrap(newParallelWriter(w, workers, cdb.tempDir, less)), nil
 }
 
 // GetReader returns a new Reader object.
 func (cdb *CDB) GetReader(reader io.ReaderAt) (Reader, error) {
-	return newReader(reader, cdb.Hasher)
+	// the signature is verified on the given reader before anything is read through the block cache
+	// or sections are loaded, so data of an unverified file is never used
+	if len(cdb.trustedKeys) > 0 {
+		if err := verifySignature(reader, cdb.trustedKeys); err != nil {
+			return nil, err
+		}
+	}
+
+	if cdb.blockCache != nil {
+		reader = newCachedReaderAt(reader, cdb.blockCache)
+	}
+
+	r, err := newReader(reader, cdb.Hasher)
+	if err != nil {
+		return nil, err
+	}
+
+	if cdb.valueCache != nil {
+		r.values, r.owner = cdb.valueCache, newCacheOwner()
+	}
+
+	if cdb.encryption != nil {
+		e, err := readEncryption(r, cdb.encryption.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		return &encryptedReader{readerImpl: r, encryption: e}, nil
+	}
+
+	return r, nil
 }
@@ -1,11 +1,15 @@
 package cdb
 
 import (
+	"bytes"
+	"context"
 	"hash/fnv"
+	"io"
 	"io/ioutil"
 	"os"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"testing"
 
 	"github.com/stretchr/testify/suite"
@@ -64,6 +68,15 @@ func (suite *CDBTestSuite) TearDownTest() {
 	suite.Nilf(err, "Can't remove cdb file: %#v", err)
 }
 
+// resetCDBFile empties the test file, writers do not truncate files, so a smaller database would leave
+// stale bytes of the previous one
+func (suite *CDBTestSuite) resetCDBFile() {
+	suite.Require().Nil(suite.cdbFile.Truncate(0))
+
+	_, err := suite.cdbFile.Seek(0, io.SeekStart)
+	suite.Require().Nil(err)
+}
+
 func (suite *CDBTestSuite) fillTestCDB() {
 
 	writer := suite.getCDBWriter()
@@ -145,11 +158,131 @@ func (suite *CDBTestSuite) TestConcurrentGet() {
 	wg.Wait()
 }
 
+func (suite *CDBTestSuite) TestPutReader() {
+	writer := suite.getCDBWriter()
+
+	for _, rec := range suite.testRecords {
+		err := writer.PutReader(rec.key, bytes.NewReader(rec.val), uint32(len(rec.val)))
+		suite.Require().Nilf(err, "Cant put new value to cdb: %#v", err)
+	}
+
+	suite.Require().Nil(writer.Close())
+
+	reader := suite.getCDBReader()
+
+	for _, rec := range suite.testRecords {
+		value, err := reader.Get(rec.key)
+		suite.Nil(err)
+		suite.Equal(rec.val, value)
+	}
+}
+
+func (suite *CDBTestSuite) TestPutReaderSizeMismatch() {
+	for _, size := range []uint32{5, 8} {
+		writer := suite.getCDBWriter()
+		suite.Require().Nil(writer.Put([]byte("key"), []byte("value")))
+
+		err := writer.PutReader([]byte("key"), bytes.NewReader([]byte("four")), size)
+		suite.Equal(ErrValueSize, err)
+
+		suite.Equal(ErrValueSize, writer.Put([]byte("key"), []byte("value")), "the writer must stay failed")
+		suite.Equal(ErrValueSize, writer.Close())
+	}
+}
+
+func (suite *CDBTestSuite) TestPutReaderDoesNotReadPastValue() {
+	value := bytes.NewReader([]byte("value and the rest"))
+
+	writer := suite.getCDBWriter()
+	suite.Require().Nil(writer.PutReader([]byte("key"), value, 5))
+	suite.Require().Nil(writer.Close())
+
+	suite.Equal(13, value.Len(), "bytes after the value must not be read")
+
+	stored, err := suite.getCDBReader().Get([]byte("key"))
+	suite.Nil(err)
+	suite.Equal([]byte("value"), stored)
+}
+
 func (suite *CDBTestSuite) TestSetHash() {
 	suite.cdbHandle.SetHash(fnv.New32)
 	suite.TestShouldReturnAllValues()
 }
 
+// ctxReaderAt records contexts passed by the cdb reader
+type ctxReaderAt struct {
+	*os.File
+	calls int
+}
+
+func (r *ctxReaderAt) ReadAtContext(ctx context.Context, p []byte, off int64) (int, error) {
+	r.calls++
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return r.ReadAt(p, off)
+}
+
+// countingReaderAt counts ReadAt calls
+type countingReaderAt struct {
+	io.ReaderAt
+	calls int64
+}
+
+func (r *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	atomic.AddInt64(&r.calls, 1)
+	return r.ReaderAt.ReadAt(p, off)
+}
+
+func (suite *CDBTestSuite) TestContextIsPassedToReaderAtContext() {
+	suite.fillTestCDB()
+
+	backend := &ctxReaderAt{File: suite.cdbFile}
+	reader, err := suite.cdbHandle.GetReader(backend)
+	suite.Require().Nil(err)
+
+	for _, rec := range suite.testRecords {
+		value, err := reader.GetContext(context.Background(), rec.key)
+		suite.Nil(err)
+		suite.Equal(rec.val, value)
+
+		exists, err := reader.HasContext(context.Background(), rec.key)
+		suite.Nil(err)
+		suite.True(exists)
+	}
+
+	suite.NotZero(backend.calls)
+}
+
+func (suite *CDBTestSuite) TestCancelledContext() {
+	suite.fillTestCDB()
+
+	reader := suite.getCDBReader()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	iterator, err := reader.IteratorContext(ctx)
+	suite.Require().Nil(err)
+
+	cancel()
+
+	value, err := reader.GetContext(ctx, suite.testRecords[0].key)
+	suite.Equal(context.Canceled, err)
+	suite.Nil(value)
+
+	exists, err := reader.HasContext(ctx, suite.testRecords[0].key)
+	suite.Equal(context.Canceled, err)
+	suite.False(exists)
+
+	ok, err := iterator.Next()
+	suite.Equal(context.Canceled, err)
+	suite.False(ok)
+
+	_, err = reader.IteratorContext(ctx)
+	suite.Equal(context.Canceled, err)
+}
+
 func BenchmarkGetReader(b *testing.B) {
 
 	n := 1000
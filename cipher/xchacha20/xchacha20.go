@@ -0,0 +1,14 @@
+// Package xchacha20 registers the XChaCha20-Poly1305 cipher of encrypted databases (see cdb.SetEncryption),
+// it is kept apart from the cdb package, so the latter does not depend on golang.org/x/crypto:
+//
+//	import _ "github.com/alldroll/cdb/cipher/xchacha20"
+package xchacha20
+
+import (
+	"github.com/alldroll/cdb"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+func init() {
+	cdb.RegisterCipher(cdb.XChaCha20Poly1305, chacha20poly1305.NewX)
+}
@@ -0,0 +1,66 @@
+package xchacha20
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alldroll/cdb"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+func TestEncryptedDatabase(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "test.cdb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	handle := cdb.New()
+	handle.SetEncryption(&cdb.EncryptionOptions{
+		Cipher:      cdb.XChaCha20Poly1305,
+		Key:         bytes.Repeat([]byte{7}, cdb.EncryptionKeySize),
+		EncryptKeys: true,
+	})
+
+	writer, err := handle.GetWriter(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writer.Put([]byte("key"), []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := handle.GetReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := reader.Get([]byte("key"))
+	if err != nil || string(value) != "value" {
+		t.Fatalf("expected value, got %q, %v", value, err)
+	}
+
+	// the stored record has the nonce of XChaCha20-Poly1305: 24 bytes
+	reader, err = cdb.New().GetReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, value := range reader.All() {
+		expected := chacha20poly1305.NonceSizeX + 1 + len("key") + len("value") + chacha20poly1305.Overhead
+		if len(value) != expected {
+			t.Errorf("expected a stored value of %d bytes, got %d", expected, len(value))
+		}
+	}
+
+	if err := reader.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
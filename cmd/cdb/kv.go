@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/alldroll/cdb"
+	"github.com/alldroll/cdb/kvserver"
+)
+
+// runKV serves lookups in a database over the Redis or memcached protocol until SIGINT or SIGTERM
+func runKV(args []string) error {
+	flags := flag.NewFlagSet("kv", flag.ExitOnError)
+	protocol := flags.String("protocol", "redis", "protocol to speak: redis or memcached")
+	addr := flags.String("addr", "", "address to listen on, :6379 for redis and :11211 for memcached by default")
+	valueCache := flags.Int("value-cache", 0, "size of the value cache in bytes, 0 disables the cache")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return errors.New("usage: kv [flags] <db.cdb>")
+	}
+
+	var newServer func(reader cdb.Reader) *kvserver.Server
+
+	switch *protocol {
+	case "redis":
+		newServer = kvserver.NewRESP
+		if *addr == "" {
+			*addr = ":6379"
+		}
+	case "memcached":
+		newServer = kvserver.NewMemcached
+		if *addr == "" {
+			*addr = ":11211"
+		}
+	default:
+		return fmt.Errorf("unknown protocol %q", *protocol)
+	}
+
+	f, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	handle := cdb.New()
+	if *valueCache > 0 {
+		handle.SetValueCache(cdb.NewValueCache(*valueCache, 0))
+	}
+
+	reader, err := handle.GetReader(f)
+	if err != nil {
+		return err
+	}
+
+	server := newServer(reader)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		<-signals
+		server.Close()
+	}()
+
+	log.Printf("serving %s on %s (%s)", flags.Arg(0), *addr, *protocol)
+
+	if err := server.ListenAndServe(*addr); err != kvserver.ErrServerClosed {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+// cdb is a tool for building and inspecting constant databases.
+//
+// Usage:
+//
+//	cdb <command> [arguments]
+//
+// Commands:
+//
+//	keygen  generate a key pair for signing databases
+//	kv      serve lookups in a database over the Redis or memcached protocol
+//	pack    build a database from a directory tree
+//	serve   serve lookups in a database over HTTP
+//	sign    sign a database
+//	verify  check that a database is signed by a trusted key
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// command runs a subcommand with the given arguments
+type command struct {
+	run   func(args []string) error
+	usage string
+}
+
+var commands = map[string]command{
+	"keygen": {runKeygen, "keygen <name>"},
+	"kv":     {runKV, "kv [flags] <db.cdb>"},
+	"pack":   {runPack, "pack [flags] <dir> <out.cdb>"},
+	"serve":  {runServe, "serve [flags] <db.cdb>"},
+	"sign":   {runSign, "sign -key <name.key> <db.cdb>"},
+	"verify": {runVerify, "verify -pubkey <name.pub> [-pubkey ...] <db.cdb>"},
+}
+
+func main() {
+	log.SetFlags(0)
+
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+	}
+
+	if err := cmd.run(os.Args[2:]); err != nil {
+		log.Fatalf("%s: %s", os.Args[1], err)
+	}
+}
+
+// usage prints usage of all commands and exits
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	fmt.Fprintf(os.Stderr, "Usage:\n")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %s %s\n", filepath.Base(os.Args[0]), commands[name].usage)
+	}
+
+	os.Exit(2)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"flag"
+	"os"
+	"strings"
+
+	"github.com/alldroll/cdb"
+)
+
+// patterns is a repeatable string flag: glob patterns, key files
+type patterns []string
+
+func (p *patterns) String() string { return strings.Join(*p, ",") }
+
+func (p *patterns) Set(value string) error {
+	*p = append(*p, value)
+	return nil
+}
+
+// runPack builds a database from a directory tree
+func runPack(args []string) error {
+	var (
+		options cdb.PackOptions
+		flags   = flag.NewFlagSet("pack", flag.ExitOnError)
+	)
+
+	flags.Var((*patterns)(&options.Include), "include", "glob of files to pack, can be repeated")
+	flags.Var((*patterns)(&options.Exclude), "exclude", "glob of files and directories to skip, can be repeated")
+	flags.BoolVar(&options.Metadata, "metadata", false, "store mode, modification time and content type of files")
+	flags.BoolVar(&options.Reproducible, "reproducible", false, "do not store modification times")
+	index := flags.Bool("index", true, "store the sorted key index for directory listings")
+	keyPath := flags.String("key", "", "file of the private key to sign the database with")
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		return errors.New("usage: pack [flags] <dir> <out.cdb>")
+	}
+
+	handle := cdb.New()
+	handle.SetIndex(*index)
+
+	if *keyPath != "" {
+		seed, err := readKey(*keyPath, ed25519.SeedSize)
+		if err != nil {
+			return err
+		}
+
+		handle.SetSigningKey(ed25519.NewKeyFromSeed(seed))
+	}
+
+	out, err := os.Create(flags.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	defer out.Close()
+
+	writer, err := handle.GetWriter(out)
+	if err != nil {
+		return err
+	}
+
+	if err := cdb.PackDir(writer, flags.Arg(0), options); err != nil {
+		return err
+	}
+
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	return out.Close()
+}
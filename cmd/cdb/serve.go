@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/alldroll/cdb"
+	"github.com/alldroll/cdb/httpserver"
+)
+
+// runServe serves lookups in a database over HTTP until SIGINT or SIGTERM, SIGHUP reloads the database
+func runServe(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := flags.String("addr", ":8080", "address to listen on")
+	valueCache := flags.Int("value-cache", 0, "size of the value cache in bytes, 0 disables the cache")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return errors.New("usage: serve [flags] <db.cdb>")
+	}
+
+	handle := cdb.New()
+	if *valueCache > 0 {
+		handle.SetValueCache(cdb.NewValueCache(*valueCache, 0))
+	}
+
+	server, err := httpserver.Open(handle, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	defer server.Close()
+
+	httpServer := &http.Server{Addr: *addr, Handler: server}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+
+	// done is closed when handlers have finished, so the database is closed only after that
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		for sig := range signals {
+			if sig != syscall.SIGHUP {
+				httpServer.Shutdown(context.Background())
+				return
+			}
+
+			if err := server.Reload(); err != nil {
+				log.Printf("reload failed: %s", err)
+			} else {
+				log.Printf("reloaded %s", flags.Arg(0))
+			}
+		}
+	}()
+
+	log.Printf("serving %s on %s", flags.Arg(0), *addr)
+
+	if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+
+	<-done
+
+	return nil
+}
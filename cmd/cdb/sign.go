@@ -0,0 +1,139 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/alldroll/cdb"
+)
+
+// Keys are stored in files as base64 text: a private key file holds the 32-byte seed,
+// a public key file holds the 32-byte public key.
+
+// runKeygen generates a key pair: <name>.key and <name>.pub
+func runKeygen(args []string) error {
+	flags := flag.NewFlagSet("keygen", flag.ExitOnError)
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return errors.New("usage: keygen <name>")
+	}
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	name := flags.Arg(0)
+
+	if err := writeKey(name+".key", private.Seed(), 0o600); err != nil {
+		return err
+	}
+
+	if err := writeKey(name+".pub", public, 0o644); err != nil {
+		return err
+	}
+
+	log.Printf("wrote %s.key and %s.pub", name, name)
+
+	return nil
+}
+
+// runSign signs a database, or replaces its signature
+func runSign(args []string) error {
+	flags := flag.NewFlagSet("sign", flag.ExitOnError)
+	keyPath := flags.String("key", "", "file of the private key")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 || *keyPath == "" {
+		return errors.New("usage: sign -key <name.key> <db.cdb>")
+	}
+
+	seed, err := readKey(*keyPath, ed25519.SeedSize)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(flags.Arg(0), os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+
+	if err := cdb.Sign(f, ed25519.NewKeyFromSeed(seed)); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// runVerify checks that a database is signed by one of the given keys
+func runVerify(args []string) error {
+	var (
+		keyPaths patterns
+		flags    = flag.NewFlagSet("verify", flag.ExitOnError)
+	)
+
+	flags.Var(&keyPaths, "pubkey", "file of a trusted public key, can be repeated")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 || len(keyPaths) == 0 {
+		return errors.New("usage: verify -pubkey <name.pub> <db.cdb>")
+	}
+
+	keys := make([]ed25519.PublicKey, len(keyPaths))
+
+	for i, path := range keyPaths {
+		key, err := readKey(path, ed25519.PublicKeySize)
+		if err != nil {
+			return err
+		}
+
+		keys[i] = key
+	}
+
+	f, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	handle := cdb.New()
+	handle.SetTrustedKeys(keys...)
+
+	if _, err := handle.GetReader(f); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s: OK\n", flags.Arg(0))
+
+	return nil
+}
+
+// writeKey writes the key into the file
+func writeKey(path string, key []byte, perm os.FileMode) error {
+	return os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), perm)
+}
+
+// readKey reads a key of the given size from the file
+func readKey(path string, size int) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != size {
+		return nil, fmt.Errorf("%s: expected a base64 key of %d bytes", path, size)
+	}
+
+	return key, nil
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// decoder converts encoded data into a readable string
+type decoder func(data []byte) (string, error)
+
+// errInvalidData tells that data does not match its codec
+var errInvalidData = errors.New("data does not match its codec")
+
+// loadDescriptors reads protobuf descriptors from the given FileDescriptorSet file, nil if path is empty
+func loadDescriptors(path string) (*protoregistry.Files, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(data, set); err != nil {
+		return nil, err
+	}
+
+	return protodesc.NewFiles(set)
+}
+
+// newDecoder returns a decoder of data encoded by the codec with the given name
+func newDecoder(codec string, files *protoregistry.Files) (decoder, error) {
+	switch {
+	case codec == "" || codec == "string" || codec == "json":
+		return decodeRaw, nil
+	case codec == "varint":
+		return decodeVarint, nil
+	case codec == "uvarint":
+		return decodeUvarint, nil
+	case strings.HasPrefix(codec, "fixed:"):
+		return decodeFixed(strings.HasPrefix(codec, "fixed:int")), nil
+	case codec == "msgpack":
+		return decodeMsgpack, nil
+	case strings.HasPrefix(codec, "protobuf:"):
+		return protoDecoder(protoreflect.FullName(strings.TrimPrefix(codec, "protobuf:")), files)
+	default:
+		return decodeBase64, nil
+	}
+}
+
+func decodeRaw(data []byte) (string, error) {
+	return string(data), nil
+}
+
+func decodeBase64(data []byte) (string, error) {
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+func decodeVarint(data []byte) (string, error) {
+	x, n := binary.Varint(data)
+	if n != len(data) {
+		return "", errInvalidData
+	}
+
+	return strconv.FormatInt(x, 10), nil
+}
+
+func decodeUvarint(data []byte) (string, error) {
+	x, n := binary.Uvarint(data)
+	if n != len(data) {
+		return "", errInvalidData
+	}
+
+	return strconv.FormatUint(x, 10), nil
+}
+
+// decodeFixed returns a decoder of big-endian integers of cdb.FixedCodec
+func decodeFixed(signed bool) decoder {
+	return func(data []byte) (string, error) {
+		var x uint64
+
+		switch len(data) {
+		case 1, 2, 4, 8:
+		default:
+			return "", errInvalidData
+		}
+
+		for _, b := range data {
+			x = x<<8 | uint64(b)
+		}
+
+		if signed {
+			shift := 64 - 8*len(data)
+			return strconv.FormatInt(int64(x<<shift)>>shift, 10), nil
+		}
+
+		return strconv.FormatUint(x, 10), nil
+	}
+}
+
+func decodeMsgpack(data []byte) (string, error) {
+	var value interface{}
+
+	if err := msgpack.Unmarshal(data, &value); err != nil {
+		return "", err
+	}
+
+	return toJSON(value)
+}
+
+// protoDecoder returns a decoder of the given message type. If the type is unknown,
+// messages are printed as JSON objects keyed by field numbers.
+func protoDecoder(name protoreflect.FullName, files *protoregistry.Files) (decoder, error) {
+	var message protoreflect.MessageDescriptor
+
+	if files != nil {
+		descriptor, err := files.FindDescriptorByName(name)
+		if err != nil {
+			return nil, err
+		}
+
+		var ok bool
+		if message, ok = descriptor.(protoreflect.MessageDescriptor); !ok {
+			return nil, fmt.Errorf("%s is not a message", name)
+		}
+	} else if messageType, err := protoregistry.GlobalTypes.FindMessageByName(name); err == nil {
+		message = messageType.Descriptor()
+	}
+
+	if message == nil {
+		return func(data []byte) (string, error) {
+			value, err := decodeWire(data)
+			if err != nil {
+				return "", err
+			}
+
+			return toJSON(value)
+		}, nil
+	}
+
+	return func(data []byte) (string, error) {
+		value := dynamicpb.NewMessage(message)
+
+		if err := proto.Unmarshal(data, value); err != nil {
+			return "", err
+		}
+
+		text, err := protojson.Marshal(value)
+
+		return string(text), err
+	}, nil
+}
+
+// decodeWire decodes a protobuf message without its schema: fields are keyed by numbers,
+// repeated fields become arrays, length-delimited fields are decoded as messages or strings if possible
+func decodeWire(data []byte) (map[string]interface{}, error) {
+	fields := make(map[string]interface{})
+
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+
+		data = data[n:]
+
+		var value interface{}
+
+		switch typ {
+		case protowire.VarintType:
+			var x uint64
+			x, n = protowire.ConsumeVarint(data)
+			value = x
+		case protowire.Fixed32Type:
+			var x uint32
+			x, n = protowire.ConsumeFixed32(data)
+			value = x
+		case protowire.Fixed64Type:
+			var x uint64
+			x, n = protowire.ConsumeFixed64(data)
+			value = x
+		case protowire.BytesType:
+			var b []byte
+			b, n = protowire.ConsumeBytes(data)
+			value = decodeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+
+		data = data[n:]
+
+		if value == nil {
+			continue
+		}
+
+		key := strconv.Itoa(int(num))
+
+		switch prev := fields[key].(type) {
+		case nil:
+			fields[key] = value
+		case []interface{}:
+			fields[key] = append(prev, value)
+		default:
+			fields[key] = []interface{}{prev, value}
+		}
+	}
+
+	return fields, nil
+}
+
+// decodeBytes returns a length-delimited field as a nested message, a string or base64, like protoc --decode_raw
+func decodeBytes(data []byte) interface{} {
+	if message, err := decodeWire(data); err == nil && len(message) > 0 {
+		return message
+	}
+
+	if utf8.Valid(data) {
+		return string(data)
+	}
+
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+// toJSON returns JSON representation of the value
+func toJSON(value interface{}) (string, error) {
+	text, err := json.Marshal(value)
+	return string(text), err
+}
@@ -1,9 +1,13 @@
-// dump.go reads a constant database from input file and prints the database contents in csv format to stdout
+// dump.go reads a constant database from input file and prints the database contents in csv format to stdout.
+// Keys and values written by cdb.TypedWriter with named codecs are decoded, e.g. protobuf and msgpack values
+// are printed as JSON, values of unknown codecs (e.g. gob) are printed in base64. Protobuf messages are decoded using the given descriptor set
+// (protoc --descriptor_set_out --include_imports), otherwise they are printed by field numbers.
 
 package main
 
 import (
 	"encoding/csv"
+	"flag"
 	"github.com/alldroll/cdb"
 	"log"
 	"os"
@@ -12,11 +16,19 @@ import (
 func main() {
 	var sourceFile *os.File
 
-	if len(os.Args) != 2 {
-		log.Fatalf("Usage: %s source", os.Args[0])
+	descriptors := flag.String("descriptors", "", "file with a FileDescriptorSet of protobuf messages")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		log.Fatalf("Usage: %s [-descriptors file] source", os.Args[0])
 	}
 
-	sourceFile, err := os.OpenFile(os.Args[1], os.O_RDONLY, 0)
+	files, err := loadDescriptors(*descriptors)
+	if err != nil {
+		log.Fatalf("[Fail to load descriptors] %s", err)
+	}
+
+	sourceFile, err = os.OpenFile(flag.Arg(0), os.O_RDONLY, 0)
 	if err != nil {
 		log.Fatalf("[Fail to open source file] %s", err)
 	}
@@ -29,7 +41,14 @@ func main() {
 		log.Fatal(err)
 	}
 
-	iterator, err := cdbReader.Iterator()
+	keyCodec, valueCodec := cdbReader.Codecs()
+
+	decodeKey, err := newDecoder(keyCodec, files)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	decodeValue, err := newDecoder(valueCodec, files)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -37,33 +56,23 @@ func main() {
 	csvWriter := csv.NewWriter(os.Stdout)
 	defer csvWriter.Flush()
 
-	for {
-		record := iterator.Record()
-
-		keyReader, keySize := record.Key()
-		key := make([]byte, keySize)
-		if _, err = keyReader.Read(key); err != nil {
-			log.Fatal(err)
-		}
-
-		valReader, valSize := record.Value()
-		value := make([]byte, valSize)
-		if _, err = valReader.Read(value); err != nil {
+	for key, value := range cdbReader.All() {
+		k, err := decodeKey(key)
+		if err != nil {
 			log.Fatal(err)
 		}
 
-		err = csvWriter.Write([]string{string(key), string(value)})
+		v, err := decodeValue(value)
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		ok, err := iterator.Next()
-		if err != nil {
+		if err := csvWriter.Write([]string{k, v}); err != nil {
 			log.Fatal(err)
 		}
+	}
 
-		if !ok {
-			break
-		}
+	if err := cdbReader.Err(); err != nil {
+		log.Fatal(err)
 	}
 }
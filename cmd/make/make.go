@@ -5,10 +5,12 @@ package main
 import (
 	"bufio"
 	"encoding/csv"
+	"fmt"
 	"github.com/alldroll/cdb"
 	"io"
 	"log"
 	"os"
+	"time"
 )
 
 func main() {
@@ -37,6 +39,12 @@ func main() {
 	defer destinationFile.Close()
 
 	cdbHandle := cdb.New()
+
+	tty := isTerminal(os.Stderr)
+	if tty {
+		cdbHandle.SetProgress(200*time.Millisecond, printProgress)
+	}
+
 	cdbWriter, err := cdbHandle.GetWriter(destinationFile)
 	if err != nil {
 		log.Fatal(err)
@@ -60,8 +68,30 @@ func main() {
 		}
 	}
 
-	err = cdbWriter.Close()
+	summary, err := cdbWriter.CloseWithSummary()
 	if err != nil {
 		log.Fatal(err)
 	}
+
+	if tty {
+		printProgress(summary.WriterStats)
+		fmt.Fprintf(os.Stderr, "\ndone: %d bytes, longest probe chain %d\n", summary.Size, summary.MaxProbe)
+	}
+}
+
+// isTerminal tells if the given file is a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// printProgress prints a progress line to stderr
+func printProgress(stats cdb.WriterStats) {
+	fmt.Fprintf(
+		os.Stderr,
+		"\r%d records, %d bytes written (%.1f%% of the limit)",
+		stats.Records,
+		stats.Bytes,
+		float64(stats.Offset)*100/float64(stats.Limit),
+	)
 }
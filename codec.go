@@ -0,0 +1,232 @@
+package cdb
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidEncoding tells that data can not be decoded by a codec
+var ErrInvalidEncoding = errors.New("invalid encoding")
+
+// Codec converts values of type T to bytes and back, it is used by TypedWriter and TypedReader.
+// Implementations must be safe for concurrent use.
+type Codec[T any] interface {
+	// Encode returns binary representation of the value
+	Encode(value T) ([]byte, error)
+	// Decode returns the value of the given binary representation
+	Decode(data []byte) (T, error)
+}
+
+// NamedCodec can be implemented by a Codec in order to record its name in the database built by TypedWriter,
+// so tools like cmd/dump can decode records without knowing their types. See Reader.Codecs.
+type NamedCodec interface {
+	// Name returns the name of the encoding, e.g. "json"
+	Name() string
+}
+
+// codecName returns the name of the given codec, empty if it does not implement NamedCodec
+func codecName(codec interface{}) string {
+	if named, ok := codec.(NamedCodec); ok {
+		return named.Name()
+	}
+
+	return ""
+}
+
+// encodeCodecs returns the payload of the codec section: size (4 bytes) and name of each codec
+func encodeCodecs(key, value string) []byte {
+	data := make([]byte, 0, 8+len(key)+len(value))
+
+	data = appendUint32(data, uint32(len(key)))
+	data = append(data, key...)
+	data = appendUint32(data, uint32(len(value)))
+
+	return append(data, value...)
+}
+
+// decodeCodecs returns names of codecs stored in the codec section
+func decodeCodecs(data []byte) (key, value string, err error) {
+	names := make([]string, 2)
+
+	for i := range names {
+		if len(data) < 4 {
+			return "", "", ErrInvalidTrailer
+		}
+
+		size := binary.LittleEndian.Uint32(data)
+		data = data[4:]
+
+		if uint64(len(data)) < uint64(size) {
+			return "", "", ErrInvalidTrailer
+		}
+
+		names[i], data = string(data[:size]), data[size:]
+	}
+
+	return names[0], names[1], nil
+}
+
+// BytesCodec implements Codec for byte slices, the data is passed as is
+type BytesCodec struct{}
+
+// Encode implements Codec interface
+func (BytesCodec) Encode(value []byte) ([]byte, error) { return value, nil }
+
+// Decode implements Codec interface
+func (BytesCodec) Decode(data []byte) ([]byte, error) { return data, nil }
+
+// StringCodec implements Codec for strings
+type StringCodec struct{}
+
+// Encode implements Codec interface
+func (StringCodec) Encode(value string) ([]byte, error) { return []byte(value), nil }
+
+// Decode implements Codec interface
+func (StringCodec) Decode(data []byte) (string, error) { return string(data), nil }
+
+// Name implements NamedCodec interface
+func (StringCodec) Name() string { return "string" }
+
+// VarintCodec implements Codec for signed integers using variable-length zig-zag encoding
+type VarintCodec[T ~int | ~int8 | ~int16 | ~int32 | ~int64] struct{}
+
+// Encode implements Codec interface
+func (VarintCodec[T]) Encode(value T) ([]byte, error) {
+	return binary.AppendVarint(nil, int64(value)), nil
+}
+
+// Decode implements Codec interface
+func (VarintCodec[T]) Decode(data []byte) (T, error) {
+	x, n := binary.Varint(data)
+
+	if n <= 0 || n != len(data) || int64(T(x)) != x {
+		return 0, ErrInvalidEncoding
+	}
+
+	return T(x), nil
+}
+
+// Name implements NamedCodec interface
+func (VarintCodec[T]) Name() string { return "varint" }
+
+// UvarintCodec implements Codec for unsigned integers using variable-length encoding
+type UvarintCodec[T ~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64] struct{}
+
+// Encode implements Codec interface
+func (UvarintCodec[T]) Encode(value T) ([]byte, error) {
+	return binary.AppendUvarint(nil, uint64(value)), nil
+}
+
+// Decode implements Codec interface
+func (UvarintCodec[T]) Decode(data []byte) (T, error) {
+	x, n := binary.Uvarint(data)
+
+	if n <= 0 || n != len(data) || uint64(T(x)) != x {
+		return 0, ErrInvalidEncoding
+	}
+
+	return T(x), nil
+}
+
+// Name implements NamedCodec interface
+func (UvarintCodec[T]) Name() string { return "uvarint" }
+
+// FixedCodec implements Codec for fixed-width integers using big-endian encoding,
+// so unsigned keys keep their numeric order in Reader.Scan
+type FixedCodec[T ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~int8 | ~int16 | ~int32 | ~int64] struct{}
+
+// Encode implements Codec interface
+func (FixedCodec[T]) Encode(value T) ([]byte, error) {
+	return binary.Append(nil, binary.BigEndian, value)
+}
+
+// Decode implements Codec interface
+func (FixedCodec[T]) Decode(data []byte) (T, error) {
+	var value T
+
+	if binary.Size(value) != len(data) {
+		return value, ErrInvalidEncoding
+	}
+
+	_, err := binary.Decode(data, binary.BigEndian, &value)
+
+	return value, err
+}
+
+// Name implements NamedCodec interface, e.g. "fixed:uint32" or "fixed:int64"
+func (FixedCodec[T]) Name() string {
+	var value T
+	value--
+
+	if value < 0 {
+		return fmt.Sprintf("fixed:int%d", binary.Size(value)*8)
+	}
+
+	return fmt.Sprintf("fixed:uint%d", binary.Size(value)*8)
+}
+
+// JSONCodec implements Codec for values of any type using encoding/json
+type JSONCodec[T any] struct{}
+
+// Encode implements Codec interface
+func (JSONCodec[T]) Encode(value T) ([]byte, error) { return json.Marshal(value) }
+
+// Decode implements Codec interface
+func (JSONCodec[T]) Decode(data []byte) (T, error) {
+	var value T
+	err := json.Unmarshal(data, &value)
+
+	return value, err
+}
+
+// Name implements NamedCodec interface
+func (JSONCodec[T]) Name() string { return "json" }
+
+// GobCodec implements Codec for values of any type using encoding/gob.
+// Each value is encoded separately, so it carries its type description.
+type GobCodec[T any] struct{}
+
+// Encode implements Codec interface
+func (GobCodec[T]) Encode(value T) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(value)
+
+	return buf.Bytes(), err
+}
+
+// Decode implements Codec interface
+func (GobCodec[T]) Decode(data []byte) (T, error) {
+	var value T
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&value)
+
+	return value, err
+}
+
+// Name implements NamedCodec interface
+func (GobCodec[T]) Name() string { return "gob" }
+
+// BinaryCodec implements Codec for types which pointers implement encoding.BinaryMarshaler and
+// encoding.BinaryUnmarshaler, e.g. BinaryCodec[time.Time, *time.Time]
+type BinaryCodec[T any, P interface {
+	*T
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+}] struct{}
+
+// Encode implements Codec interface
+func (BinaryCodec[T, P]) Encode(value T) ([]byte, error) {
+	return P(&value).MarshalBinary()
+}
+
+// Decode implements Codec interface
+func (BinaryCodec[T, P]) Decode(data []byte) (T, error) {
+	var value T
+	err := P(&value).UnmarshalBinary(data)
+
+	return value, err
+}
@@ -0,0 +1,24 @@
+// Package msgpack provides a MessagePack codec for cdb.TypedWriter and cdb.TypedReader,
+// it is kept apart from the cdb package, so the latter does not depend on msgpack.
+package msgpack
+
+import "github.com/vmihailenco/msgpack/v5"
+
+// Codec implements cdb.Codec for values of any type using MessagePack
+type Codec[T any] struct{}
+
+// Encode implements cdb.Codec interface
+func (Codec[T]) Encode(value T) ([]byte, error) {
+	return msgpack.Marshal(value)
+}
+
+// Decode implements cdb.Codec interface
+func (Codec[T]) Decode(data []byte) (T, error) {
+	var value T
+	err := msgpack.Unmarshal(data, &value)
+
+	return value, err
+}
+
+// Name implements cdb.NamedCodec interface
+func (Codec[T]) Name() string { return "msgpack" }
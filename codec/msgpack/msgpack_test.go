@@ -0,0 +1,36 @@
+package msgpack
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/alldroll/cdb"
+)
+
+func TestCodec(t *testing.T) {
+	type user struct {
+		Name string
+		Age  int
+	}
+
+	var codec cdb.Codec[user] = Codec[user]{}
+	value := user{"carol", 50}
+
+	data, err := codec.Encode(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := codec.Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(value, decoded) {
+		t.Errorf("expected %v, got %v", value, decoded)
+	}
+
+	if name := codec.(cdb.NamedCodec).Name(); name != "msgpack" {
+		t.Errorf("unexpected codec name %q", name)
+	}
+}
@@ -0,0 +1,30 @@
+// Package proto provides a codec of protobuf messages for cdb.TypedWriter and cdb.TypedReader,
+// it is kept apart from the cdb package, so the latter does not depend on protobuf.
+package proto
+
+import "google.golang.org/protobuf/proto"
+
+// Codec implements cdb.Codec for protobuf messages, T is a pointer to a generated message type, e.g. *pb.User.
+// Its name is "protobuf:" followed by the full name of the message, e.g. "protobuf:example.User".
+type Codec[T proto.Message] struct{}
+
+// Encode implements cdb.Codec interface
+func (Codec[T]) Encode(value T) ([]byte, error) {
+	return proto.Marshal(value)
+}
+
+// Decode implements cdb.Codec interface
+func (Codec[T]) Decode(data []byte) (T, error) {
+	var zero T
+
+	value := zero.ProtoReflect().Type().New().Interface().(T)
+	err := proto.Unmarshal(data, value)
+
+	return value, err
+}
+
+// Name implements cdb.NamedCodec interface
+func (Codec[T]) Name() string {
+	var zero T
+	return "protobuf:" + string(zero.ProtoReflect().Descriptor().FullName())
+}
@@ -0,0 +1,33 @@
+package proto
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alldroll/cdb"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestCodec(t *testing.T) {
+	var codec cdb.Codec[*timestamppb.Timestamp] = Codec[*timestamppb.Timestamp]{}
+	value := timestamppb.New(time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC))
+
+	data, err := codec.Encode(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := codec.Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !proto.Equal(value, decoded) {
+		t.Errorf("expected %v, got %v", value, decoded)
+	}
+
+	if name := codec.(cdb.NamedCodec).Name(); name != "protobuf:google.protobuf.Timestamp" {
+		t.Errorf("unexpected codec name %q", name)
+	}
+}
@@ -0,0 +1,93 @@
+package cdb
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testCodec checks that the given values survive a round trip through the codec
+func testCodec[T any](t *testing.T, codec Codec[T], values ...T) {
+	t.Helper()
+
+	for _, value := range values {
+		data, err := codec.Encode(value)
+		if err != nil {
+			t.Fatalf("can't encode %v: %v", value, err)
+		}
+
+		decoded, err := codec.Decode(data)
+		if err != nil {
+			t.Fatalf("can't decode %v: %v", value, err)
+		}
+
+		if !reflect.DeepEqual(value, decoded) {
+			t.Errorf("expected %v, got %v", value, decoded)
+		}
+	}
+}
+
+func TestCodecs(t *testing.T) {
+	type user struct {
+		Name string
+		Age  int
+	}
+
+	testCodec[[]byte](t, BytesCodec{}, []byte("value"), []byte{})
+	testCodec[string](t, StringCodec{}, "", "value")
+	testCodec[int64](t, VarintCodec[int64]{}, 0, -1, 1<<40, -1<<63)
+	testCodec[int8](t, VarintCodec[int8]{}, -128, 127)
+	testCodec[uint32](t, UvarintCodec[uint32]{}, 0, 300, 1<<32-1)
+	testCodec[uint16](t, FixedCodec[uint16]{}, 0, 1<<16-1)
+	testCodec[int64](t, FixedCodec[int64]{}, -1, 1<<62)
+	testCodec[user](t, JSONCodec[user]{}, user{"alice", 30})
+	testCodec[user](t, GobCodec[user]{}, user{"bob", 40})
+	testCodec[time.Time](t, BinaryCodec[time.Time, *time.Time]{}, time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC))
+}
+
+func TestCodecNames(t *testing.T) {
+	names := map[string]interface{}{
+		"":             BytesCodec{},
+		"string":       StringCodec{},
+		"varint":       VarintCodec[int]{},
+		"uvarint":      UvarintCodec[uint8]{},
+		"fixed:uint16": FixedCodec[uint16]{},
+		"fixed:int64":  FixedCodec[int64]{},
+		"json":         JSONCodec[int]{},
+		"gob":          GobCodec[int]{},
+	}
+
+	for expected, codec := range names {
+		if name := codecName(codec); name != expected {
+			t.Errorf("expected %q, got %q", expected, name)
+		}
+	}
+}
+
+func TestFixedCodecKeepsOrder(t *testing.T) {
+	codec := FixedCodec[uint32]{}
+
+	a, _ := codec.Encode(255)
+	b, _ := codec.Encode(256)
+
+	if bytes.Compare(a, b) >= 0 {
+		t.Errorf("encoded values should keep the numeric order")
+	}
+}
+
+func TestCodecsRejectInvalidData(t *testing.T) {
+	big, _ := VarintCodec[int64]{}.Encode(1 << 20)
+
+	if _, err := (VarintCodec[int8]{}).Decode(big); err != ErrInvalidEncoding {
+		t.Errorf("overflow should be detected, got %v", err)
+	}
+
+	if _, err := (UvarintCodec[uint64]{}).Decode([]byte{0x80}); err != ErrInvalidEncoding {
+		t.Errorf("truncated varint should be detected, got %v", err)
+	}
+
+	if _, err := (FixedCodec[uint32]{}).Decode([]byte{1, 2}); err != ErrInvalidEncoding {
+		t.Errorf("short data should be detected, got %v", err)
+	}
+}
@@ -0,0 +1,578 @@
+package cdb
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"sync"
+)
+
+// Records of encrypted databases are stored as <key, nonce + sealed value>, the key of a record is
+// the additional authenticated data, so values can not be moved between keys. If keys are encrypted too,
+// records are stored as <HMAC-SHA256 of the key, nonce + sealed uvarint(len(key)) + key + value>.
+// Keys of the cipher and of the HMAC are derived with HKDF-SHA256 from the caller key and a random salt
+// of the database, so databases encrypted with the same key do not share subkeys and nonce collisions
+// are bounded per database. The cipher, the mode, the salt and a check value of the key are stored
+// in the "encr" trailer section.
+
+// Cipher is an AEAD cipher of encrypted databases
+type Cipher byte
+
+const (
+	// AESGCM is AES-256-GCM with random 96-bit nonces
+	AESGCM Cipher = iota + 1
+	// XChaCha20Poly1305 is XChaCha20-Poly1305 with random 192-bit nonces. It is registered
+	// by the github.com/alldroll/cdb/cipher/xchacha20 package, see RegisterCipher.
+	XChaCha20Poly1305
+)
+
+const (
+	// Size of keys of encrypted databases
+	EncryptionKeySize = 32
+	// Tag of the section which describes the encryption, "encr"
+	encryptionSection = 0x72636e65
+	// Size of the random salt of an encrypted database
+	encryptionSaltSize = 32
+	// Size of the payload of the encryption section: cipher, flags, salt, key check value
+	encryptionSectionSize = 2 + encryptionSaltSize + sha256.Size
+	// Flag of the encryption section which tells that keys are encrypted
+	encryptedKeysFlag = 1
+)
+
+var (
+	// ErrEncryptionKeySize tells that the key given to SetEncryption is not EncryptionKeySize bytes long
+	ErrEncryptionKeySize = fmt.Errorf("cdb encryption key must be %d bytes", EncryptionKeySize)
+	// ErrUnknownCipher tells that a cipher is not supported or its package is not imported, see RegisterCipher
+	ErrUnknownCipher = errors.New("cdb unknown cipher")
+	// ErrNotEncrypted tells that a database is opened with an encryption key, but it is not encrypted
+	ErrNotEncrypted = errors.New("cdb database is not encrypted")
+	// ErrWrongKey tells that a database is encrypted with another key
+	ErrWrongKey = errors.New("cdb encryption key does not match the database")
+	// ErrEncryptedKeys tells that keys of the database are encrypted, so they can not be scanned by range
+	ErrEncryptedKeys = errors.New("cdb keys are encrypted, range scans are not supported")
+)
+
+// TamperError tells that a record of an encrypted database failed authentication:
+// the record was modified, truncated or moved to another key.
+type TamperError struct {
+	// Key is the key of the record, it is the stored (HMAC) key when keys are encrypted and the record was not looked up
+	Key []byte
+}
+
+// Error implements the error interface
+func (e *TamperError) Error() string {
+	return fmt.Sprintf("cdb record of key %q failed authentication", e.Key)
+}
+
+// EncryptionOptions describes the encryption of databases, see CDB.SetEncryption
+type EncryptionOptions struct {
+	// Cipher encrypts records of new databases, readers take it from the database
+	Cipher Cipher
+	// Key is a secret key of EncryptionKeySize bytes
+	Key []byte
+	// EncryptKeys tells writers to encrypt keys as well as values, readers take it from the database
+	EncryptKeys bool
+}
+
+// SetEncryption tells the cdb to encrypt values (and optionally keys) of new databases and to decrypt
+// values of read databases. Keys are looked up by their HMAC if they are encrypted, so lookups
+// do not reveal plaintext keys, but range scans (Scan, Prefix) are not supported and SetOrder orders records by HMACs.
+// Reader returns *TamperError if a record fails authentication, Has does not read values, so it does not authenticate.
+// Nil disables the encryption, such readers return stored records of encrypted databases as is.
+// Given value will be used only for new instances of Reader, Writer.
+func (cdb *CDB) SetEncryption(options *EncryptionOptions) {
+	cdb.encryption = options
+}
+
+var (
+	// ciphers are constructors of AEADs of registered ciphers
+	ciphersMu sync.RWMutex
+	ciphers   = map[Cipher]func(key []byte) (cipher.AEAD, error){AESGCM: newGCM}
+)
+
+// RegisterCipher makes the cipher available to writers and readers of encrypted databases, newAEAD returns
+// its AEAD of the given key of EncryptionKeySize bytes. It is called by init functions of packages of ciphers
+// which depend on other modules, e.g. github.com/alldroll/cdb/cipher/xchacha20, so the cdb package does not:
+//
+//	import _ "github.com/alldroll/cdb/cipher/xchacha20"
+//
+// AESGCM is always available.
+func RegisterCipher(c Cipher, newAEAD func(key []byte) (cipher.AEAD, error)) {
+	ciphersMu.Lock()
+	defer ciphersMu.Unlock()
+
+	ciphers[c] = newAEAD
+}
+
+// newGCM returns the AES-GCM AEAD of the given key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// encryption encrypts and decrypts records of a database
+type encryption struct {
+	aead        cipher.AEAD
+	macKey      []byte
+	salt        []byte
+	check       []byte
+	cipher      Cipher
+	encryptKeys bool
+}
+
+// newDatabaseEncryption returns the encryption of a new database with a random salt
+func newDatabaseEncryption(options *EncryptionOptions) (*encryption, error) {
+	salt := make([]byte, encryptionSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	return newEncryption(options.Cipher, options.Key, salt, options.EncryptKeys)
+}
+
+// newEncryption returns a new encryption of the given cipher and mode, subkeys are derived from the key and the salt
+func newEncryption(c Cipher, key, salt []byte, encryptKeys bool) (*encryption, error) {
+	if len(key) != EncryptionKeySize {
+		return nil, ErrEncryptionKeySize
+	}
+
+	ciphersMu.RLock()
+	newAEAD, ok := ciphers[c]
+	ciphersMu.RUnlock()
+
+	if !ok {
+		return nil, ErrUnknownCipher
+	}
+
+	aead, err := newAEAD(deriveKey(key, salt, "cdb cipher key"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &encryption{
+		aead:        aead,
+		macKey:      deriveKey(key, salt, "cdb key mac"),
+		salt:        salt,
+		check:       deriveKey(key, salt, "cdb key check"),
+		cipher:      c,
+		encryptKeys: encryptKeys,
+	}, nil
+}
+
+// readEncryption returns the encryption described by the section of the database
+func readEncryption(r *readerImpl, key []byte) (*encryption, error) {
+	if err := r.loadTrailer(); err != nil {
+		return nil, err
+	}
+
+	s, ok := r.sections[encryptionSection]
+	if !ok {
+		return nil, ErrNotEncrypted
+	}
+
+	data, err := s.read(r.reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) != encryptionSectionSize {
+		return nil, ErrInvalidTrailer
+	}
+
+	salt, check := data[2:2+encryptionSaltSize], data[2+encryptionSaltSize:]
+
+	e, err := newEncryption(Cipher(data[0]), key, salt, data[1]&encryptedKeysFlag != 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if !hmac.Equal(e.check, check) {
+		return nil, ErrWrongKey
+	}
+
+	return e, nil
+}
+
+// deriveKey returns a subkey of the key and the salt for the given purpose. It is HKDF-SHA256 (RFC 5869)
+// with the purpose as info, a subkey is a single block of the output.
+func deriveKey(key, salt []byte, purpose string) []byte {
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(key)
+
+	expand := hmac.New(sha256.New, extract.Sum(nil))
+	expand.Write([]byte(purpose))
+	expand.Write([]byte{1})
+
+	return expand.Sum(nil)
+}
+
+// section returns the payload of the encryption section
+func (e *encryption) section() []byte {
+	data := make([]byte, 0, encryptionSectionSize)
+	data = append(data, byte(e.cipher), 0)
+
+	if e.encryptKeys {
+		data[1] |= encryptedKeysFlag
+	}
+
+	return append(append(data, e.salt...), e.check...)
+}
+
+// storedKey returns the key a record of the given key is stored with
+func (e *encryption) storedKey(key []byte) []byte {
+	if !e.encryptKeys {
+		return key
+	}
+
+	mac := hmac.New(sha256.New, e.macKey)
+	mac.Write(key)
+
+	return mac.Sum(nil)
+}
+
+// seal returns the stored value of the record
+func (e *encryption) seal(stored, key, value []byte) ([]byte, error) {
+	nonceSize := e.aead.NonceSize()
+	plain := value
+
+	if e.encryptKeys {
+		plain = binary.AppendUvarint(make([]byte, 0, binary.MaxVarintLen32+len(key)+len(value)), uint64(len(key)))
+		plain = append(append(plain, key...), value...)
+	}
+
+	data := make([]byte, nonceSize, nonceSize+len(plain)+e.aead.Overhead())
+	if _, err := rand.Read(data); err != nil {
+		return nil, err
+	}
+
+	return e.aead.Seal(data, data, plain, stored), nil
+}
+
+// open authenticates and decrypts the stored record, returns its key and value
+func (e *encryption) open(stored, data []byte) ([]byte, []byte, error) {
+	nonceSize := e.aead.NonceSize()
+
+	if len(data) < nonceSize {
+		return nil, nil, &TamperError{Key: stored}
+	}
+
+	plain, err := e.aead.Open(nil, data[:nonceSize], data[nonceSize:], stored)
+	if err != nil {
+		return nil, nil, &TamperError{Key: stored}
+	}
+
+	if !e.encryptKeys {
+		return stored, plain, nil
+	}
+
+	size, n := binary.Uvarint(plain)
+	if n <= 0 || uint64(len(plain)-n) < size {
+		return nil, nil, &TamperError{Key: stored}
+	}
+
+	return plain[n : n+int(size) : n+int(size)], plain[n+int(size):], nil
+}
+
+// openValue is like open, but returns only the value of the looked up key
+func (e *encryption) openValue(key, stored, data []byte) ([]byte, error) {
+	k, value, err := e.open(stored, data)
+	if err != nil || !bytes.Equal(k, key) {
+		return nil, &TamperError{Key: key}
+	}
+
+	return value, nil
+}
+
+// encryptedWriter implements Writer interface, it encrypts records and passes them to the underlying writer
+type encryptedWriter struct {
+	Writer
+	encryption *encryption
+}
+
+// Put encrypts and saves a new associated pair <key, value> into databases. Returns an error on failure.
+func (w *encryptedWriter) Put(key, value []byte) error {
+	stored := w.encryption.storedKey(key)
+
+	data, err := w.encryption.seal(stored, key, value)
+	if err != nil {
+		return err
+	}
+
+	return w.Writer.Put(stored, data)
+}
+
+// PutReader reads exactly size bytes of the value into memory, encrypts and saves a new associated pair
+// <key, value> into databases. It does not stream the value: it is sealed as a whole, so it is buffered
+// in memory along with its ciphertext. If the reader has less bytes than declared, ErrValueSize is returned.
+func (w *encryptedWriter) PutReader(key []byte, value io.Reader, size uint32) error {
+	buf, err := readValue(value, size)
+	if err != nil {
+		return err
+	}
+
+	return w.Put(key, buf)
+}
+
+// setCodecs records names of codecs of keys and values
+func (w *encryptedWriter) setCodecs(key, value string) {
+	if recorder, ok := w.Writer.(codecRecorder); ok {
+		recorder.setCodecs(key, value)
+	}
+}
+
+// wrap returns an encrypting writer over the given one if the database is encrypted
+func (w *writerImpl) wrap(writer Writer) Writer {
+	if w.encryption == nil {
+		return writer
+	}
+
+	return &encryptedWriter{Writer: writer, encryption: w.encryption}
+}
+
+// encryptedReader implements Reader interface, it looks up records by stored keys and decrypts them
+type encryptedReader struct {
+	*readerImpl
+	encryption *encryption
+}
+
+// Get returns the first value associated with the given key
+func (r *encryptedReader) Get(key []byte) ([]byte, error) {
+	return r.GetContext(context.Background(), key)
+}
+
+// GetContext is like Get, but aborts reading as soon as ctx is done.
+func (r *encryptedReader) GetContext(ctx context.Context, key []byte) ([]byte, error) {
+	stored := r.encryption.storedKey(key)
+
+	data, err := r.readerImpl.GetContext(ctx, stored)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.encryption.openValue(key, stored, data)
+}
+
+// Has returns true if the given key exists, otherwise returns false.
+func (r *encryptedReader) Has(key []byte) (bool, error) {
+	return r.HasContext(context.Background(), key)
+}
+
+// HasContext is like Has, but aborts reading as soon as ctx is done.
+func (r *encryptedReader) HasContext(ctx context.Context, key []byte) (bool, error) {
+	return r.readerImpl.HasContext(ctx, r.encryption.storedKey(key))
+}
+
+// Iterator returns new Iterator object that points on first record
+func (r *encryptedReader) Iterator() (Iterator, error) {
+	return r.IteratorContext(context.Background())
+}
+
+// IteratorContext is like Iterator, but the returned Iterator passes ctx to every read it issues.
+func (r *encryptedReader) IteratorContext(ctx context.Context) (Iterator, error) {
+	return r.wrap(r.readerImpl.IteratorContext(ctx))
+}
+
+// IteratorAt returns a new Iterator object that points on the first record associated with the given key.
+func (r *encryptedReader) IteratorAt(key []byte) (Iterator, error) {
+	return r.wrap(r.readerImpl.IteratorAt(r.encryption.storedKey(key)))
+}
+
+// Scan returns an Iterator over records with keys in [start, end), ErrEncryptedKeys if keys are encrypted
+func (r *encryptedReader) Scan(start, end []byte) (Iterator, error) {
+	if r.encryption.encryptKeys {
+		return nil, ErrEncryptedKeys
+	}
+
+	return r.wrap(r.readerImpl.Scan(start, end))
+}
+
+// Prefix returns an Iterator over records with keys starting with the prefix, ErrEncryptedKeys if keys are encrypted
+func (r *encryptedReader) Prefix(prefix []byte) (Iterator, error) {
+	if r.encryption.encryptKeys {
+		return nil, ErrEncryptedKeys
+	}
+
+	return r.wrap(r.readerImpl.Prefix(prefix))
+}
+
+// wrap returns an iterator which decrypts records of the given one
+func (r *encryptedReader) wrap(iterator Iterator, err error) (Iterator, error) {
+	if iterator == nil || err != nil {
+		return iterator, err
+	}
+
+	return &encryptedIterator{Iterator: iterator, encryption: r.encryption}, nil
+}
+
+// All returns a sequence of all decrypted records in file order.
+func (r *encryptedReader) All() iter.Seq2[[]byte, []byte] {
+	return func(yield func(key, value []byte) bool) {
+		r.walk(true, func(key, value []byte, err error) bool {
+			if err == nil {
+				key, value, err = r.encryption.open(key, value)
+			}
+
+			if err != nil {
+				r.setErr(err)
+				return false
+			}
+
+			return yield(key, value)
+		})
+	}
+}
+
+// Keys returns a sequence of keys of all records in file order, records are decrypted if keys are encrypted.
+func (r *encryptedReader) Keys() iter.Seq[[]byte] {
+	if !r.encryption.encryptKeys {
+		return r.readerImpl.Keys()
+	}
+
+	return func(yield func(key []byte) bool) {
+		for key := range r.All() {
+			if !yield(key) {
+				return
+			}
+		}
+	}
+}
+
+// ValuesFor returns a sequence of all decrypted values associated with the given key in the order of Put calls.
+func (r *encryptedReader) ValuesFor(key []byte) iter.Seq[[]byte] {
+	return func(yield func(value []byte) bool) {
+		var (
+			stored  = r.encryption.storedKey(key)
+			openErr error
+		)
+
+		err := r.readValues(stored, func(data []byte) bool {
+			value, err := r.encryption.openValue(key, stored, data)
+			if err != nil {
+				openErr = err
+				return false
+			}
+
+			return yield(value)
+		})
+
+		if err == nil {
+			err = openErr
+		}
+
+		if err != nil {
+			r.setErr(err)
+		}
+	}
+}
+
+// encryptedIterator implements Iterator interface, it decrypts the current record on demand
+type encryptedIterator struct {
+	Iterator
+	encryption *encryption
+	opened     bool
+	key, value []byte
+	err        error
+}
+
+// Next moves the iterator to the next record. Returns true on success otherwise returns false.
+func (i *encryptedIterator) Next() (bool, error) {
+	i.opened, i.key, i.value, i.err = false, nil, nil, nil
+
+	return i.Iterator.Next()
+}
+
+// Key returns the decrypted key of the current record
+func (i *encryptedIterator) Key() ([]byte, error) {
+	if !i.encryption.encryptKeys {
+		return i.Iterator.Key()
+	}
+
+	i.open()
+
+	return i.key, i.err
+}
+
+// Value returns the decrypted value of the current record
+func (i *encryptedIterator) Value() ([]byte, error) {
+	i.open()
+
+	return i.value, i.err
+}
+
+// Record returns the decrypted current record, its readers fail if the record failed authentication
+func (i *encryptedIterator) Record() Record {
+	i.open()
+
+	return &decryptedRecord{key: i.key, value: i.value, err: i.err}
+}
+
+// open decrypts the current record once
+func (i *encryptedIterator) open() {
+	if i.opened {
+		return
+	}
+
+	i.opened = true
+
+	stored, err := i.Iterator.Key()
+	if err != nil {
+		i.err = err
+		return
+	}
+
+	data, err := i.Iterator.Value()
+	if err != nil {
+		i.err = err
+		return
+	}
+
+	i.key, i.value, i.err = i.encryption.open(bytes.Clone(stored), data)
+}
+
+// decryptedRecord implements Record interface over a decrypted record
+type decryptedRecord struct {
+	key, value []byte
+	err        error
+}
+
+// Key returns io.Reader with the record's key and key size.
+func (r *decryptedRecord) Key() (io.Reader, uint32) {
+	return r.reader(r.key), uint32(len(r.key))
+}
+
+// Value returns io.Reader with the record's value and value size.
+func (r *decryptedRecord) Value() (io.Reader, uint32) {
+	return r.reader(r.value), uint32(len(r.value))
+}
+
+// reader returns a reader of the data, or of the error of the record
+func (r *decryptedRecord) reader(data []byte) io.Reader {
+	if r.err != nil {
+		return &errorReader{r.err}
+	}
+
+	return bytes.NewReader(data)
+}
+
+// errorReader is an io.Reader which always fails
+type errorReader struct {
+	err error
+}
+
+// Read returns the error
+func (r *errorReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
@@ -0,0 +1,272 @@
+package cdb
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/hex"
+	"errors"
+	"io"
+	"testing"
+)
+
+// encryptionKey is a key of encrypted test databases
+var encryptionKey = bytes.Repeat([]byte{7}, EncryptionKeySize)
+
+// testCipher is AES-GCM with 128-bit nonces, it checks that registered ciphers are used
+const testCipher Cipher = 0x7f
+
+func init() {
+	RegisterCipher(testCipher, func(key []byte) (cipher.AEAD, error) {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+
+		return cipher.NewGCMWithNonceSize(block, 16)
+	})
+}
+
+// fillEncryptedCDB writes test records into an encrypted database
+func (suite *CDBTestSuite) fillEncryptedCDB(c Cipher, encryptKeys bool) {
+	suite.cdbHandle.SetEncryption(&EncryptionOptions{Cipher: c, Key: encryptionKey, EncryptKeys: encryptKeys})
+
+	writer := suite.getCDBWriter()
+	for _, rec := range suite.testRecords {
+		suite.Require().Nil(writer.Put(rec.key, rec.val))
+	}
+
+	suite.Require().Nil(writer.Close())
+}
+
+func (suite *CDBTestSuite) TestEncryptedGet() {
+	for _, c := range []Cipher{AESGCM, testCipher} {
+		for _, encryptKeys := range []bool{false, true} {
+			_, err := suite.cdbFile.Seek(0, io.SeekStart)
+			suite.Require().Nil(err)
+
+			suite.fillEncryptedCDB(c, encryptKeys)
+			reader := suite.getCDBReader()
+
+			for _, rec := range suite.testRecords {
+				value, err := reader.Get(rec.key)
+				suite.Nil(err)
+				suite.Equal(rec.val, value)
+
+				found, err := reader.Has(rec.key)
+				suite.Nil(err)
+				suite.True(found)
+			}
+
+			_, err = reader.Get([]byte("missing"))
+			suite.Equal(ErrEntryNotFound, err)
+
+			var keys [][]byte
+
+			for key, value := range reader.All() {
+				keys = append(keys, key)
+				suite.Equal("val"+string(key[3:]), string(value))
+			}
+
+			suite.Nil(reader.Err())
+			suite.Len(keys, len(suite.testRecords))
+		}
+	}
+}
+
+func (suite *CDBTestSuite) TestEncryptedKeysAreHidden() {
+	suite.fillEncryptedCDB(testCipher, true)
+
+	data, err := io.ReadAll(io.NewSectionReader(suite.cdbFile, 0, 1<<20))
+	suite.Require().Nil(err)
+
+	for _, rec := range suite.testRecords {
+		suite.False(bytes.Contains(data, rec.key))
+		suite.False(bytes.Contains(data, rec.val))
+	}
+
+	// records are stored by HMACs of keys, so a plain reader does not find them
+	suite.cdbHandle.SetEncryption(nil)
+	_, err = suite.getCDBReader().Get(suite.testRecords[0].key)
+	suite.Equal(ErrEntryNotFound, err)
+}
+
+func (suite *CDBTestSuite) TestEncryptedIterator() {
+	suite.fillEncryptedCDB(AESGCM, true)
+	reader := suite.getCDBReader()
+
+	iterator, err := reader.Iterator()
+	suite.Require().Nil(err)
+
+	for i := 0; ; i++ {
+		key, err := iterator.Key()
+		suite.Require().Nil(err)
+		suite.Equal(suite.testRecords[i].key, key)
+
+		value, err := iterator.Value()
+		suite.Require().Nil(err)
+		suite.Equal(suite.testRecords[i].val, value)
+
+		valueReader, size := iterator.Record().Value()
+		data, err := io.ReadAll(valueReader)
+		suite.Nil(err)
+		suite.Equal(suite.testRecords[i].val, data)
+		suite.Equal(uint32(len(data)), size)
+
+		if ok, err := iterator.Next(); !ok {
+			suite.Nil(err)
+			suite.Equal(len(suite.testRecords)-1, i)
+			break
+		}
+	}
+
+	iterator, err = reader.IteratorAt(suite.testRecords[3].key)
+	suite.Require().Nil(err)
+
+	key, err := iterator.Key()
+	suite.Nil(err)
+	suite.Equal(suite.testRecords[3].key, key)
+
+	_, err = reader.Prefix([]byte("key"))
+	suite.Equal(ErrEncryptedKeys, err)
+}
+
+func (suite *CDBTestSuite) TestEncryptedScan() {
+	suite.cdbHandle.SetIndex(true)
+	suite.fillEncryptedCDB(AESGCM, false)
+
+	iterator, err := suite.getCDBReader().Prefix([]byte("key1"))
+	suite.Require().Nil(err)
+
+	value, err := iterator.Value()
+	suite.Nil(err)
+	suite.Equal([]byte("val1"), value)
+}
+
+func (suite *CDBTestSuite) TestEncryptedTampering() {
+	suite.fillEncryptedCDB(AESGCM, false)
+
+	// flip the last byte of the first value
+	rec := suite.testRecords[0]
+	position := int64(tablesRefsSize + 8 + len(rec.key) + 12 + len(rec.val) + 16 - 1)
+	b := make([]byte, 1)
+
+	_, err := suite.cdbFile.ReadAt(b, position)
+	suite.Require().Nil(err)
+	b[0] ^= 1
+	_, err = suite.cdbFile.WriteAt(b, position)
+	suite.Require().Nil(err)
+
+	reader := suite.getCDBReader()
+
+	_, err = reader.Get(rec.key)
+	var tamperErr *TamperError
+	suite.Require().True(errors.As(err, &tamperErr))
+	suite.Equal(rec.key, tamperErr.Key)
+
+	value, err := reader.Get(suite.testRecords[1].key)
+	suite.Nil(err)
+	suite.Equal(suite.testRecords[1].val, value)
+
+	for range reader.All() {
+	}
+	suite.True(errors.As(reader.Err(), &tamperErr))
+}
+
+func (suite *CDBTestSuite) TestEncryptedMovedValue() {
+	suite.fillEncryptedCDB(testCipher, false)
+
+	// a value sealed for another key fails authentication
+	suite.cdbHandle.SetEncryption(nil)
+
+	sealed, err := suite.getCDBReader().Get(suite.testRecords[1].key)
+	suite.Require().Nil(err)
+
+	r, err := newReader(suite.cdbFile, nil)
+	suite.Require().Nil(err)
+
+	e, err := readEncryption(r, encryptionKey)
+	suite.Require().Nil(err)
+
+	_, err = e.openValue(suite.testRecords[2].key, suite.testRecords[2].key, sealed)
+	suite.IsType(&TamperError{}, err)
+}
+
+func (suite *CDBTestSuite) TestEncryptedDatabasesDoNotShareSubkeys() {
+	// stored records of a database built twice with the same key
+	build := func() map[string][]byte {
+		suite.resetCDBFile()
+		suite.fillEncryptedCDB(AESGCM, true)
+		suite.cdbHandle.SetEncryption(nil)
+
+		stored := make(map[string][]byte)
+		reader := suite.getCDBReader()
+
+		for key, value := range reader.All() {
+			stored[string(key)] = value
+		}
+
+		suite.Require().Nil(reader.Err())
+
+		return stored
+	}
+
+	first, second := build(), build()
+	suite.Len(first, len(suite.testRecords))
+
+	for key, value := range second {
+		_, ok := first[key]
+		suite.False(ok, "keyed hashes should differ between databases")
+
+		for _, other := range first {
+			suite.NotEqual(other[12:], value[12:], "ciphertexts should differ between databases")
+		}
+	}
+}
+
+func TestDeriveKey(t *testing.T) {
+	// RFC 5869, test case 1: the first block of the output
+	key := bytes.Repeat([]byte{0x0b}, 22)
+	salt, _ := hex.DecodeString("000102030405060708090a0b0c")
+	info, _ := hex.DecodeString("f0f1f2f3f4f5f6f7f8f9")
+
+	expected := "3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf"
+	if actual := hex.EncodeToString(deriveKey(key, salt, string(info))); actual != expected {
+		t.Errorf("expected %s, got %s", expected, actual)
+	}
+}
+
+func (suite *CDBTestSuite) TestEncryptionErrors() {
+	suite.cdbHandle.SetEncryption(&EncryptionOptions{Cipher: AESGCM, Key: []byte("short")})
+	_, err := suite.cdbHandle.GetWriter(suite.cdbFile)
+	suite.Equal(ErrEncryptionKeySize, err)
+
+	suite.cdbHandle.SetEncryption(&EncryptionOptions{Key: encryptionKey})
+	_, err = suite.cdbHandle.GetWriter(suite.cdbFile)
+	suite.Equal(ErrUnknownCipher, err)
+
+	// the cipher is registered by a package which is not imported
+	suite.cdbHandle.SetEncryption(&EncryptionOptions{Cipher: XChaCha20Poly1305, Key: encryptionKey})
+	_, err = suite.cdbHandle.GetWriter(suite.cdbFile)
+	suite.Equal(ErrUnknownCipher, err)
+
+	suite.fillEncryptedCDB(AESGCM, false)
+
+	suite.cdbHandle.SetEncryption(&EncryptionOptions{Key: bytes.Repeat([]byte{8}, EncryptionKeySize)})
+	_, err = suite.cdbHandle.GetReader(suite.cdbFile)
+	suite.Equal(ErrWrongKey, err)
+
+	// readers take the cipher and the mode from the database
+	suite.cdbHandle.SetEncryption(&EncryptionOptions{Cipher: XChaCha20Poly1305, Key: encryptionKey, EncryptKeys: true})
+	value, err := suite.getCDBReader().Get(suite.testRecords[0].key)
+	suite.Nil(err)
+	suite.Equal(suite.testRecords[0].val, value)
+}
+
+func (suite *CDBTestSuite) TestEncryptionOfPlainDatabase() {
+	suite.fillTestCDB()
+
+	suite.cdbHandle.SetEncryption(&EncryptionOptions{Key: encryptionKey})
+	_, err := suite.cdbHandle.GetReader(suite.cdbFile)
+	suite.Equal(ErrNotEncrypted, err)
+}
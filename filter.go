@@ -0,0 +1,105 @@
+package cdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+const (
+	// Max number of probes of the bloom filter
+	maxFilterProbes = 30
+	// Max size of the bit set of the bloom filter, positions of bits are 32-bit
+	maxFilterSize = math.MaxUint32 / 8
+)
+
+// errInvalidFilter tells that the filter section is corrupted
+var errInvalidFilter = fmt.Errorf("%w: invalid filter", ErrInvalidTrailer)
+
+// bloomFilter is a Bloom filter over keys of a database. It tells for sure that a key is absent,
+// so most of misses do not touch the hash tables.
+//
+// The filter is stored as: number of probes (4 bytes), bit set.
+// Probes are derived from fnv64a hash of a key using double hashing.
+type bloomFilter struct {
+	probes uint32
+	bits   []byte
+}
+
+// newBloomFilter returns a new empty bloomFilter for the given number of keys using bitsPerKey bits per key
+func newBloomFilter(keys int, bitsPerKey int) *bloomFilter {
+	probes := uint32(math.Round(float64(bitsPerKey) * math.Ln2))
+
+	if probes < 1 {
+		probes = 1
+	}
+	if probes > maxFilterProbes {
+		probes = maxFilterProbes
+	}
+
+	n := (keys*bitsPerKey + 7) / 8
+	if n < 8 {
+		n = 8
+	}
+	if n > maxFilterSize {
+		n = maxFilterSize
+	}
+
+	return &bloomFilter{
+		probes: probes,
+		bits:   make([]byte, n),
+	}
+}
+
+// decodeBloomFilter returns bloomFilter stored in the given data
+func decodeBloomFilter(data []byte) (*bloomFilter, error) {
+	if len(data) <= 4 {
+		return nil, errInvalidFilter
+	}
+
+	f := &bloomFilter{
+		probes: binary.LittleEndian.Uint32(data),
+		bits:   data[4:],
+	}
+
+	if f.probes < 1 || f.probes > maxFilterProbes || len(f.bits) > maxFilterSize {
+		return nil, errInvalidFilter
+	}
+
+	return f, nil
+}
+
+// encode returns binary representation of the filter
+func (f *bloomFilter) encode() []byte {
+	data := make([]byte, 4, 4+len(f.bits))
+	binary.LittleEndian.PutUint32(data, f.probes)
+
+	return append(data, f.bits...)
+}
+
+// add adds the given key hash to the filter
+func (f *bloomFilter) add(h uint64) {
+	m := uint32(len(f.bits) * 8)
+	h1, h2 := uint32(h), uint32(h>>32)
+
+	for i := uint32(0); i < f.probes; i++ {
+		bit := (h1 + i*h2) % m
+		f.bits[bit>>3] |= 1 << (bit & 7)
+	}
+}
+
+// mayContain returns false if the key with the given hash is definitely absent
+func (f *bloomFilter) mayContain(h uint64) bool {
+	m := uint32(len(f.bits) * 8)
+	h1, h2 := uint32(h), uint32(h>>32)
+
+	for i := uint32(0); i < f.probes; i++ {
+		bit := (h1 + i*h2) % m
+
+		if f.bits[bit>>3]&(1<<(bit&7)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
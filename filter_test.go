@@ -0,0 +1,180 @@
+package cdb
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"testing"
+)
+
+func (suite *CDBTestSuite) TestFilter() {
+	suite.cdbHandle.SetFilter(10)
+	suite.fillTestCDB()
+
+	backend := &countingReaderAt{ReaderAt: suite.cdbFile}
+	reader, err := suite.cdbHandle.GetReader(backend)
+	suite.Require().Nil(err)
+	suite.Require().Nil(reader.(*readerImpl).loadTrailer())
+	suite.Require().NotNil(reader.(*readerImpl).filter)
+
+	for _, rec := range suite.testRecords {
+		value, err := reader.Get(rec.key)
+		suite.Nil(err)
+		suite.Equal(rec.val, value)
+	}
+
+	calls, misses := backend.calls, 0
+
+	for i := 0; i < 1000; i++ {
+		exists, err := reader.Has([]byte("missing" + strconv.Itoa(i)))
+		suite.Nil(err)
+
+		if exists {
+			misses++
+		}
+	}
+
+	suite.Zero(misses)
+	suite.True(backend.calls-calls < 100, "most of misses should be answered by the filter")
+
+	suite.TestIterator()
+}
+
+func (suite *CDBTestSuite) TestFilterOnEmptyDataSet() {
+	suite.cdbHandle.SetFilter(10)
+	suite.TestShouldReturnNilOnNonExistingKeys()
+}
+
+// tablesEnd returns the end of the hash tables of the test database
+func (suite *CDBTestSuite) tablesEnd() int64 {
+	r, err := newReader(suite.cdbFile, nil)
+	suite.Require().Nil(err)
+
+	return r.tablesEnd()
+}
+
+func (suite *CDBTestSuite) TestStaleTrailerIsIgnored() {
+	// the trailer of another database with a filter which has none of test keys
+	other := New()
+	other.SetFilter(10)
+
+	f, err := os.CreateTemp("", "test_*.cdb")
+	suite.Require().Nil(err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	writer, err := other.GetWriter(f)
+	suite.Require().Nil(err)
+	suite.Require().Nil(writer.Put([]byte("other"), []byte("value")))
+	suite.Require().Nil(writer.Close())
+
+	r, err := newReader(f, nil)
+	suite.Require().Nil(err)
+
+	stale, err := io.ReadAll(io.NewSectionReader(f, r.tablesEnd(), 1<<20))
+	suite.Require().Nil(err)
+
+	suite.fillTestCDB()
+	_, err = suite.cdbFile.WriteAt(stale, suite.tablesEnd())
+	suite.Require().Nil(err)
+
+	reader := suite.getCDBReader()
+	suite.Nil(reader.(*readerImpl).loadTrailer())
+	suite.Nil(reader.(*readerImpl).filter)
+
+	for _, rec := range suite.testRecords {
+		value, err := reader.Get(rec.key)
+		suite.Nil(err)
+		suite.Equal(rec.val, value)
+	}
+}
+
+func (suite *CDBTestSuite) TestTruncatedTrailer() {
+	suite.fillTestCDB()
+
+	r, err := newReader(suite.cdbFile, nil)
+	suite.Require().Nil(err)
+
+	t, err := r.readTrailer()
+	suite.Require().Nil(err)
+
+	// a valid table of contents which promises more data than the file has
+	var buf bytes.Buffer
+	suite.Require().Nil(writeSections(&buf, []extension{{tag: filterSection, data: make([]byte, 1000)}}, t.binding))
+	_, err = suite.cdbFile.WriteAt(buf.Bytes()[:buf.Len()-500], r.tablesEnd())
+	suite.Require().Nil(err)
+
+	_, err = suite.getCDBReader().Get(suite.testRecords[0].key)
+	suite.Equal(ErrInvalidTrailer, err)
+}
+
+// eofReaderAt returns io.EOF along with the last bytes of the file, which io.ReaderAt allows
+type eofReaderAt struct {
+	*os.File
+}
+
+func (r eofReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.File.ReadAt(p, off)
+	if info, statErr := r.File.Stat(); err == nil && statErr == nil && off+int64(n) == info.Size() {
+		err = io.EOF
+	}
+
+	return n, err
+}
+
+func (suite *CDBTestSuite) TestTrailerAtEndOfFileWithEOF() {
+	suite.cdbHandle.SetFilter(10)
+	suite.fillTestCDB()
+
+	reader, err := suite.cdbHandle.GetReader(eofReaderAt{suite.cdbFile})
+	suite.Require().Nil(err)
+	suite.Require().Nil(reader.(*readerImpl).loadTrailer())
+	suite.NotNil(reader.(*readerImpl).filter)
+}
+
+func TestDecodeInvalidBloomFilter(t *testing.T) {
+	for _, data := range [][]byte{nil, {1, 0, 0, 0}, {0, 0, 0, 0, 0xff}, {31, 0, 0, 0, 0xff}} {
+		if _, err := decodeBloomFilter(data); !errors.Is(err, ErrInvalidTrailer) {
+			t.Errorf("filter %v should be rejected, got %v", data, err)
+		}
+	}
+}
+
+func TestBloomFilterFalsePositiveRate(t *testing.T) {
+	n := 10000
+	hashes := make([]uint64, n)
+
+	for i := range hashes {
+		hashes[i] = fnv64a([]byte(strconv.Itoa(i)))
+	}
+
+	built := newBloomFilter(n, 10)
+	for _, h := range hashes {
+		built.add(h)
+	}
+
+	filter, err := decodeBloomFilter(built.encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, h := range hashes {
+		if !filter.mayContain(h) {
+			t.Fatalf("filter must contain all added keys")
+		}
+	}
+
+	falsePositives := 0
+
+	for i := n; i < 2*n; i++ {
+		if filter.mayContain(fnv64a([]byte(strconv.Itoa(i)))) {
+			falsePositives++
+		}
+	}
+
+	if rate := float64(falsePositives) / float64(n); rate > 0.03 {
+		t.Errorf("false positive rate is too high: %f", rate)
+	}
+}
@@ -0,0 +1,120 @@
+package cdb
+
+import (
+	"fmt"
+	"hash"
+	"os"
+	"strconv"
+	"testing"
+)
+
+// collidingHash has only 65536 distinct (but well spread) values, so slot hashes of different keys often match
+type collidingHash struct {
+	hash.Hash32
+}
+
+func newCollidingHash() hash.Hash32 {
+	return &collidingHash{NewHash()}
+}
+
+func (h *collidingHash) Sum32() uint32 {
+	return (h.Hash32.Sum32() & 0xffff) * 2654435761
+}
+
+func (suite *CDBTestSuite) TestFingerprints() {
+	suite.cdbHandle.SetHash(newCollidingHash)
+	suite.cdbHandle.SetFingerprints(true)
+
+	for i := 0; i < 5000; i++ {
+		suite.testRecords = append(suite.testRecords, testCDBRecord{
+			key: []byte(fmt.Sprintf("present%04d", i)),
+			val: []byte(strconv.Itoa(i)),
+		})
+	}
+
+	suite.fillTestCDB()
+	reader := suite.getCDBReader().(*readerImpl)
+	suite.Require().Nil(reader.loadTrailer())
+	suite.Require().NotNil(reader.fingerprints)
+
+	suite.TestShouldReturnAllValues()
+	suite.TestIteratorAt()
+
+	withFingerprints := suite.countMissReads()
+
+	suite.cdbHandle.SetFingerprints(false)
+	suite.resetCDBFile()
+	suite.fillTestCDB()
+	suite.Require().Nil(suite.getCDBReader().(*readerImpl).fingerprints)
+
+	suite.True(withFingerprints < suite.countMissReads(), "fingerprints should reduce the number of reads")
+}
+
+func (suite *CDBTestSuite) TestFingerprintsOnEmptyDataSet() {
+	suite.cdbHandle.SetFingerprints(true)
+	suite.TestShouldReturnNilOnNonExistingKeys()
+}
+
+// countMissReads returns the number of ReadAt calls issued by lookups of absent keys.
+// Absent keys have the same length as present ones, so a hash collision costs a key read.
+func (suite *CDBTestSuite) countMissReads() int64 {
+	backend := &countingReaderAt{ReaderAt: suite.cdbFile}
+	reader, err := suite.cdbHandle.GetReader(backend)
+	suite.Require().Nil(err)
+
+	backend.calls = 0
+
+	for i := 0; i < 1000; i++ {
+		exists, err := reader.Has([]byte(fmt.Sprintf("missing%04d", i)))
+		suite.Nil(err)
+		suite.False(exists)
+	}
+
+	return backend.calls
+}
+
+func BenchmarkReaderMissWithFingerprints(b *testing.B) {
+	benchmarkReaderMiss(b, true)
+}
+
+func BenchmarkReaderMissWithoutFingerprints(b *testing.B) {
+	benchmarkReaderMiss(b, false)
+}
+
+func benchmarkReaderMiss(b *testing.B, fingerprints bool) {
+
+	n := 100000
+	f, _ := os.Create("test.cdb")
+	defer f.Close()
+	defer os.Remove("test.cdb")
+
+	handle := New()
+	handle.SetHash(newCollidingHash)
+	handle.SetFingerprints(fingerprints)
+	writer, _ := handle.GetWriter(f)
+
+	for i := 0; i < n; i++ {
+		key := []byte(fmt.Sprintf("present%08d", i))
+		writer.Put(key, key)
+	}
+
+	writer.Close()
+
+	backend := &countingReaderAt{ReaderAt: f}
+	reader, _ := handle.GetReader(backend)
+
+	keys := make([][]byte, n)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("missing%08d", i))
+	}
+
+	backend.calls = 0
+
+	b.ResetTimer()
+	for j := 0; j < b.N; j++ {
+		reader.Has(keys[j%n])
+	}
+	b.StopTimer()
+
+	b.Logf("%.2f ReadAt calls per miss", float64(backend.calls)/float64(b.N))
+}
@@ -0,0 +1,377 @@
+package cdb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// readOnlyFS implements fs.FS, fs.ReadFileFS, fs.StatFS and fs.ReadDirFS over a Reader
+type readOnlyFS struct {
+	reader Reader
+	// dirs maps a directory to its children (true for directories), it is built on the first use
+	// if the database has no key index
+	dirs     map[string]map[string]bool
+	dirsOnce sync.Once
+	dirsErr  error
+}
+
+// FS returns a read-only filesystem over the given reader. Keys are slash-separated paths (see fs.ValidPath),
+// values are contents of files, directories are implied by keys. The returned value implements fs.FS,
+// fs.ReadFileFS, fs.StatFS and fs.ReadDirFS, so it can be used with http.FS, template.ParseFS, fs.WalkDir, etc.
+// Opened files are io.ReadSeeker and io.ReaderAt, their contents are read lazily.
+// Modes and modification times of files are taken from metadata stored by Pack, if any.
+//
+// Directories are listed using the key index (see CDB.SetIndex). If there is no index,
+// all keys are read once on the first directory access.
+func FS(reader Reader) fs.FS {
+	return &readOnlyFS{reader: reader}
+}
+
+// Open implements fs.FS interface
+func (f *readOnlyFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if name != "." {
+		content, err := f.open(name)
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+
+		if content != nil {
+			info := fileInfo{name: path.Base(name), size: content.Size()}
+
+			if metadata, err := ReadMetadata(f.reader, name); err == nil {
+				info.mode, info.modTime = metadata.Mode, metadata.ModTime
+			}
+
+			return &file{SectionReader: content, info: info}, nil
+		}
+	}
+
+	entries, err := f.readDir(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	return &dir{info: fileInfo{name: path.Base(name), dir: true}, entries: entries}, nil
+}
+
+// ReadFile implements fs.ReadFileFS interface
+func (f *readOnlyFS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrInvalid}
+	}
+
+	value, err := f.reader.Get([]byte(name))
+	if err == ErrEntryNotFound {
+		err = fs.ErrNotExist
+	}
+
+	if err != nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+	}
+
+	return value, nil
+}
+
+// Stat implements fs.StatFS interface
+func (f *readOnlyFS) Stat(name string) (fs.FileInfo, error) {
+	file, err := f.Open(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: errors.Unwrap(err)}
+	}
+
+	return file.Stat()
+}
+
+// ReadDir implements fs.ReadDirFS interface
+func (f *readOnlyFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	entries, err := f.readDir(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+
+	return entries, nil
+}
+
+// open returns a reader of the value of the given key, nil if there is no such key
+func (f *readOnlyFS) open(name string) (*io.SectionReader, error) {
+	key := []byte(name)
+
+	if r, ok := f.reader.(*readerImpl); ok {
+		reader := r.bind(context.Background())
+
+		entry, err := r.findEntry(reader, key)
+		if err != nil || entry == nil {
+			return nil, err
+		}
+
+		return io.NewSectionReader(reader, int64(entry.position), int64(entry.size)), nil
+	}
+
+	value, err := f.reader.Get(key)
+	if err == ErrEntryNotFound {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return io.NewSectionReader(bytes.NewReader(value), 0, int64(len(value))), nil
+}
+
+// readDir returns entries of the given directory sorted by name
+func (f *readOnlyFS) readDir(name string) ([]fs.DirEntry, error) {
+	children, err := f.children(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if children == nil && name != "." {
+		return nil, fs.ErrNotExist
+	}
+
+	entries := make([]fs.DirEntry, 0, len(children))
+
+	for child, isDir := range children {
+		entries = append(entries, &dirEntry{fs: f, path: path.Join(name, child), name: child, dir: isDir})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	return entries, nil
+}
+
+// children returns names of files and directories (true) in the given directory, nil if there is no such directory.
+// With the key index keys of a subdirectory are not read, a new scan starts after them.
+func (f *readOnlyFS) children(name string) (map[string]bool, error) {
+	prefix := ""
+	if name != "." {
+		prefix = name + "/"
+	}
+
+	var (
+		children = make(map[string]bool)
+		end      = prefixEnd([]byte(prefix))
+	)
+
+	for start := []byte(prefix); start != nil; {
+		iterator, err := f.reader.Scan(start, end)
+		if err == ErrNoIndex {
+			f.dirsOnce.Do(f.buildDirs)
+			return f.dirs[name], f.dirsErr
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if iterator == nil {
+			break
+		}
+
+		if start, err = scanChildren(iterator, prefix, children); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(children) == 0 {
+		return nil, nil
+	}
+
+	return children, nil
+}
+
+// scanChildren adds children of a directory to the given set from keys with the given prefix yielded
+// by the iterator up to the first subdirectory. Returns the key which follows keys of the subdirectory
+// ("0" follows "/"), nil if the iterator is exhausted.
+func scanChildren(iterator Iterator, prefix string, children map[string]bool) ([]byte, error) {
+	for {
+		key, err := iterator.Key()
+		if err != nil {
+			return nil, err
+		}
+
+		rest := string(key[len(prefix):])
+		addChild(children, rest)
+
+		if child, _, isDir := strings.Cut(rest, "/"); isDir {
+			return []byte(prefix + child + "0"), nil
+		}
+
+		ok, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
+			return nil, nil
+		}
+	}
+}
+
+// buildDirs reads all keys and builds the tree of directories
+func (f *readOnlyFS) buildDirs() {
+	f.dirs = make(map[string]map[string]bool)
+
+	add := func(parent, child string, isDir bool) bool {
+		if f.dirs[parent] == nil {
+			f.dirs[parent] = make(map[string]bool)
+		}
+
+		known, ok := f.dirs[parent][child]
+		f.dirs[parent][child] = known || isDir
+
+		return ok && known == isDir
+	}
+
+	for key := range f.reader.Keys() {
+		name := string(key)
+
+		if !fs.ValidPath(name) || name == "." {
+			continue
+		}
+
+		add(path.Dir(name), path.Base(name), false)
+
+		// mark parents as directories up to the first known one
+		for dir := path.Dir(name); dir != "." && !add(path.Dir(dir), path.Base(dir), true); {
+			dir = path.Dir(dir)
+		}
+	}
+
+	f.dirsErr = f.reader.Err()
+}
+
+// addChild adds the first element of the given relative path to children of a directory
+func addChild(children map[string]bool, rest string) {
+	child, _, isDir := strings.Cut(rest, "/")
+
+	if child == "" || child == "." || child == ".." {
+		return
+	}
+
+	children[child] = children[child] || isDir
+}
+
+// fileInfo implements fs.FileInfo interface, zero mode means the default one
+type fileInfo struct {
+	name    string
+	size    int64
+	dir     bool
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (i fileInfo) Name() string { return i.name }
+
+func (i fileInfo) Size() int64 { return i.size }
+
+func (i fileInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0555
+	}
+
+	if i.mode != 0 {
+		return i.mode.Perm()
+	}
+
+	return 0444
+}
+
+func (i fileInfo) ModTime() time.Time { return i.modTime }
+
+func (i fileInfo) IsDir() bool { return i.dir }
+
+func (i fileInfo) Sys() interface{} { return nil }
+
+// file implements fs.File interface, it reads the value lazily
+type file struct {
+	*io.SectionReader
+	info fileInfo
+}
+
+func (f *file) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+func (f *file) Close() error { return nil }
+
+// dir implements fs.ReadDirFile interface
+type dir struct {
+	info    fileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *dir) Stat() (fs.FileInfo, error) { return d.info, nil }
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: errors.New("is a directory")}
+}
+
+func (d *dir) Close() error { return nil }
+
+// ReadDir implements fs.ReadDirFile interface
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.offset:]
+
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return rest, nil
+	}
+
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+
+	if n > len(rest) {
+		n = len(rest)
+	}
+
+	d.offset += n
+
+	return rest[:n], nil
+}
+
+// dirEntry implements fs.DirEntry interface, the size of a file is read on Info call
+type dirEntry struct {
+	fs         *readOnlyFS
+	path, name string
+	dir        bool
+}
+
+func (e *dirEntry) Name() string { return e.name }
+
+func (e *dirEntry) IsDir() bool { return e.dir }
+
+func (e *dirEntry) Type() fs.FileMode {
+	if e.dir {
+		return fs.ModeDir
+	}
+
+	return 0
+}
+
+func (e *dirEntry) Info() (fs.FileInfo, error) {
+	if e.dir {
+		return fileInfo{name: e.name, dir: true}, nil
+	}
+
+	return e.fs.Stat(e.path)
+}
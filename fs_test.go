@@ -0,0 +1,133 @@
+package cdb
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing/fstest"
+)
+
+var testFiles = map[string]string{
+	"index.html":           "<html></html>",
+	"templates/base.tmpl":  "{{.}}",
+	"templates/mail/x.txt": "mail",
+	"config/app.yaml":      "debug: true",
+	"config-old":           "legacy",
+}
+
+func (suite *CDBTestSuite) getTestFS(withIndex bool) fs.FS {
+	suite.cdbHandle.SetIndex(withIndex)
+	writer := suite.getCDBWriter()
+
+	for name, content := range testFiles {
+		suite.Require().Nil(writer.Put([]byte(name), []byte(content)))
+	}
+
+	suite.Require().Nil(writer.Close())
+
+	return FS(suite.getCDBReader())
+}
+
+func (suite *CDBTestSuite) TestFS() {
+	for _, withIndex := range []bool{true, false} {
+		fsys := suite.getTestFS(withIndex)
+
+		names := make([]string, 0, len(testFiles))
+		for name := range testFiles {
+			names = append(names, name)
+		}
+
+		suite.Nil(fstest.TestFS(fsys, names...), "with index: %v", withIndex)
+
+		entries, err := fs.ReadDir(fsys, ".")
+		suite.Require().Nil(err)
+
+		var listing []string
+		for _, entry := range entries {
+			listing = append(listing, entry.Name())
+		}
+
+		suite.Equal([]string{"config", "config-old", "index.html", "templates"}, listing)
+
+		content, err := fs.ReadFile(fsys, "templates/mail/x.txt")
+		suite.Nil(err)
+		suite.Equal("mail", string(content))
+
+		_, err = fs.Stat(fsys, "missing")
+		suite.ErrorIs(err, fs.ErrNotExist)
+
+		_, err = fsys.Open("/index.html")
+		suite.ErrorIs(err, fs.ErrInvalid)
+
+		_, err = suite.cdbFile.Seek(0, io.SeekStart)
+		suite.Require().Nil(err)
+	}
+}
+
+func (suite *CDBTestSuite) TestFSFileIsSeekable() {
+	fsys := suite.getTestFS(false)
+
+	f, err := fsys.Open("config/app.yaml")
+	suite.Require().Nil(err)
+	defer f.Close()
+
+	seeker, ok := f.(io.ReadSeeker)
+	suite.Require().True(ok)
+
+	_, err = seeker.Seek(7, io.SeekStart)
+	suite.Nil(err)
+
+	rest, err := io.ReadAll(seeker)
+	suite.Nil(err)
+	suite.Equal("true", string(rest))
+}
+
+func (suite *CDBTestSuite) TestFSWithFileServer() {
+	server := httptest.NewServer(http.FileServer(http.FS(suite.getTestFS(true))))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/templates/base.tmpl")
+	suite.Require().Nil(err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	suite.Nil(err)
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	suite.Equal("{{.}}", string(body))
+}
+
+func (suite *CDBTestSuite) TestFSReadDirSkipsSubdirectories() {
+	suite.cdbHandle.SetIndex(true)
+	writer := suite.getCDBWriter()
+
+	for i := 0; i < 1000; i++ {
+		suite.Require().Nil(writer.Put([]byte(fmt.Sprintf("big/sub/%04d", i)), []byte("x")))
+	}
+
+	for _, name := range []string{"a.txt", "big.txt", "big/file", "z.txt"} {
+		suite.Require().Nil(writer.Put([]byte(name), []byte("x")))
+	}
+
+	suite.Require().Nil(writer.Close())
+
+	backend := &countingReaderAt{ReaderAt: suite.cdbFile}
+	reader, err := suite.cdbHandle.GetReader(backend)
+	suite.Require().Nil(err)
+
+	entries, err := fs.ReadDir(FS(reader), ".")
+	suite.Require().Nil(err)
+
+	var listing []string
+	for _, entry := range entries {
+		listing = append(listing, entry.Name())
+	}
+
+	suite.Equal([]string{"a.txt", "big", "big.txt", "z.txt"}, listing)
+	suite.Less(backend.calls, int64(200), "keys of subdirectories should not be read")
+
+	entries, err = fs.ReadDir(FS(reader), "big")
+	suite.Require().Nil(err)
+	suite.Len(entries, 2)
+}
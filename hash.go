@@ -49,3 +49,26 @@ func (h *hashImpl) BlockSize() int {
 func (h *hashImpl) Size() int {
 	return size
 }
+
+const (
+	fnv64Offset = 14695981039346656037
+	fnv64Prime  = 1099511628211
+)
+
+// fnv64a returns FNV-1a 64-bit hash of the given key. It is independent of Hasher and is used
+// for optional structures (filters, fingerprints) that must not share collisions with the hash tables.
+func fnv64a(key []byte) uint64 {
+	h := uint64(fnv64Offset)
+
+	for _, c := range key {
+		h ^= uint64(c)
+		h *= fnv64Prime
+	}
+
+	return h
+}
+
+// fingerprint returns the second 32-bit hash of a key stored along with a hash table slot
+func fingerprint(kh uint64) uint32 {
+	return uint32(kh) ^ uint32(kh>>32)
+}
@@ -0,0 +1,246 @@
+package cdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// Default size of a page fetched by HTTPReaderAt
+	defaultPageSize = defaultBlockSize
+	// Default number of pages kept by HTTPReaderAt
+	defaultCachePages = 1024
+)
+
+var (
+	// ErrRangeNotSupported tells that a remote server ignores HTTP Range requests
+	ErrRangeNotSupported = errors.New("remote server does not support range requests")
+	// ErrUnexpectedRange tells that a remote server returned bytes other than the requested ones
+	ErrUnexpectedRange = errors.New("remote server returned an unexpected range")
+)
+
+// HTTPReaderAt implements ReaderAtContext on top of HTTP Range requests, so a cdb file that is stored
+// on a web server or in S3-compatible object storage can be opened with CDB.GetReader without downloading it.
+//
+// The 2048-byte header is fetched once and kept in memory, other reads are served from an LRU cache
+// of fixed-size pages. So a Get usually costs one ranged read of a hash table page and one of a record page.
+// HTTPReaderAt is safe for concurrent use.
+type HTTPReaderAt struct {
+	url    string
+	client *http.Client
+	header http.Header
+	cache  *BlockCache
+	owner  uint64
+
+	mu       sync.Mutex
+	refs     []byte
+	requests int64
+}
+
+// NewHTTPReaderAt returns a new HTTPReaderAt for the given url.
+// If client is nil, http.DefaultClient is used.
+func NewHTTPReaderAt(url string, client *http.Client) *HTTPReaderAt {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &HTTPReaderAt{
+		url:    url,
+		client: client,
+		header: make(http.Header),
+		cache:  NewBlockCache(defaultPageSize*defaultCachePages, defaultPageSize, LRU),
+		owner:  newCacheOwner(),
+	}
+}
+
+// SetHeader sets a header that will be sent with every request (for example, Authorization).
+func (h *HTTPReaderAt) SetHeader(key, value string) {
+	h.header.Set(key, value)
+}
+
+// SetCache changes the size of a fetched page and the number of pages kept in memory.
+// It should be called before the first read.
+func (h *HTTPReaderAt) SetCache(pageSize, pages int) {
+	h.cache = NewBlockCache(pageSize*pages, pageSize, LRU)
+}
+
+// CacheStats returns hit/miss counters of the page cache.
+func (h *HTTPReaderAt) CacheStats() CacheStats {
+	return h.cache.Stats()
+}
+
+// Requests returns the number of HTTP requests that were issued so far.
+func (h *HTTPReaderAt) Requests() int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.requests
+}
+
+// ReadAt implements io.ReaderAt interface
+func (h *HTTPReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	return h.ReadAtContext(context.Background(), p, off)
+}
+
+// ReadAtContext implements ReaderAtContext interface
+func (h *HTTPReaderAt) ReadAtContext(ctx context.Context, p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+
+	if off+int64(len(p)) <= tablesRefsSize {
+		return h.readRefs(ctx, p, off)
+	}
+
+	return h.cache.readAt(&contextReaderAt{ctx: ctx, reader: rangeReaderAt{h}}, h.owner, p, off)
+}
+
+// readRefs serves reads of the header, which is fetched only once
+func (h *HTTPReaderAt) readRefs(ctx context.Context, p []byte, off int64) (int, error) {
+	h.mu.Lock()
+	refs := h.refs
+	h.mu.Unlock()
+
+	if refs == nil {
+		refs = make([]byte, tablesRefsSize)
+		n, err := h.fetch(ctx, refs, 0)
+
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+
+		refs = refs[:n]
+
+		h.mu.Lock()
+		h.refs = refs
+		h.mu.Unlock()
+	}
+
+	if off >= int64(len(refs)) {
+		return 0, io.EOF
+	}
+
+	n := copy(p, refs[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+// fetch reads len(p) bytes starting from off with one Range request
+func (h *HTTPReaderAt) fetch(ctx context.Context, p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.url, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	for key, values := range h.header {
+		req.Header[key] = values
+	}
+
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, off+int64(len(p))-1))
+
+	h.mu.Lock()
+	h.requests++
+	h.mu.Unlock()
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusRequestedRangeNotSatisfiable:
+		return 0, io.EOF
+	case http.StatusOK:
+		io.Copy(ioutil.Discard, resp.Body)
+		return 0, ErrRangeNotSupported
+	default:
+		return 0, fmt.Errorf("unexpected response status for %s: %s", h.url, resp.Status)
+	}
+
+	// a proxy may return another or a truncated range, so the range is checked before bytes are used
+	start, end, size, err := parseContentRange(resp.Header.Get("Content-Range"))
+	if err != nil {
+		return 0, err
+	}
+
+	length := end - start + 1
+	if start != off || (length < int64(len(p)) && end+1 != size) {
+		return 0, ErrUnexpectedRange
+	}
+
+	n, err := io.ReadFull(resp.Body, p[:min(length, int64(len(p)))])
+	if err == io.ErrUnexpectedEOF {
+		return n, ErrUnexpectedRange
+	}
+
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+
+	return n, err
+}
+
+// parseContentRange parses the value of a Content-Range header "bytes start-end/size",
+// size is -1 if it is unknown ("*")
+func parseContentRange(value string) (start, end, size int64, err error) {
+	rest, ok := strings.CutPrefix(value, "bytes ")
+	if !ok {
+		return 0, 0, 0, ErrUnexpectedRange
+	}
+
+	bounds, total, ok := strings.Cut(rest, "/")
+	if !ok {
+		return 0, 0, 0, ErrUnexpectedRange
+	}
+
+	first, last, ok := strings.Cut(bounds, "-")
+	if !ok {
+		return 0, 0, 0, ErrUnexpectedRange
+	}
+
+	size = -1
+
+	start, err1 := strconv.ParseInt(first, 10, 64)
+	end, err2 := strconv.ParseInt(last, 10, 64)
+	if total != "*" {
+		size, err = strconv.ParseInt(total, 10, 64)
+	}
+
+	if err1 != nil || err2 != nil || err != nil || start < 0 || end < start || (size >= 0 && end >= size) {
+		return 0, 0, 0, ErrUnexpectedRange
+	}
+
+	return start, end, size, nil
+}
+
+// rangeReaderAt implements ReaderAtContext, it issues a Range request for each read
+type rangeReaderAt struct {
+	*HTTPReaderAt
+}
+
+// ReadAt implements io.ReaderAt interface
+func (r rangeReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	return r.fetch(context.Background(), p, off)
+}
+
+// ReadAtContext implements ReaderAtContext interface
+func (r rangeReaderAt) ReadAtContext(ctx context.Context, p []byte, off int64) (int, error) {
+	return r.fetch(ctx, p, off)
+}
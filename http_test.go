@@ -0,0 +1,143 @@
+package cdb
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func (suite *CDBTestSuite) serveTestCDB() *httptest.Server {
+	suite.fillTestCDB()
+
+	data, err := ioutil.ReadFile(suite.cdbFile.Name())
+	suite.Require().Nil(err)
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "test.cdb", time.Time{}, bytes.NewReader(data))
+	}))
+}
+
+func (suite *CDBTestSuite) TestHTTPReaderAt() {
+	server := suite.serveTestCDB()
+	defer server.Close()
+
+	backend := NewHTTPReaderAt(server.URL, server.Client())
+	reader, err := suite.cdbHandle.GetReader(backend)
+	suite.Require().Nil(err)
+
+	for _, rec := range suite.testRecords {
+		value, err := reader.Get(rec.key)
+		suite.Nil(err)
+		suite.Equal(rec.val, value)
+	}
+
+	missing, err := reader.Has([]byte("missing"))
+	suite.Nil(err)
+	suite.False(missing)
+
+	iterator, err := reader.Iterator()
+	suite.Require().Nil(err)
+
+	for i, rec := range suite.testRecords {
+		suite.EqualKeyValue(iterator, rec)
+
+		ok, err := iterator.Next()
+		suite.Nil(err)
+		suite.Equal(i != len(suite.testRecords)-1, ok)
+	}
+}
+
+func (suite *CDBTestSuite) TestHTTPReaderAtRequestsPerGet() {
+	for i := 0; i < 1000; i++ {
+		stri := strconv.Itoa(i)
+		suite.testRecords = append(suite.testRecords, testCDBRecord{
+			key: []byte("item" + stri),
+			val: bytes.Repeat([]byte(stri), 10),
+		})
+	}
+
+	server := suite.serveTestCDB()
+	defer server.Close()
+
+	backend := NewHTTPReaderAt(server.URL, server.Client())
+	backend.SetCache(512, 2)
+
+	reader, err := suite.cdbHandle.GetReader(backend)
+	suite.Require().Nil(err)
+	suite.Equal(int64(1), backend.Requests())
+
+	before := backend.Requests()
+
+	for _, rec := range suite.testRecords {
+		value, err := reader.Get(rec.key)
+		suite.Nil(err)
+		suite.Equal(rec.val, value)
+	}
+
+	perGet := float64(backend.Requests()-before) / float64(len(suite.testRecords))
+	suite.True(perGet <= 2, "too many requests per Get: %f", perGet)
+}
+
+func (suite *CDBTestSuite) TestHTTPReaderAtWithoutRangeSupport() {
+	suite.fillTestCDB()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, tablesRefsSize))
+	}))
+	defer server.Close()
+
+	_, err := NewHTTPReaderAt(server.URL, server.Client()).ReadAt(make([]byte, 8), 0)
+	suite.Equal(ErrRangeNotSupported, err)
+}
+
+func (suite *CDBTestSuite) TestHTTPReaderAtChecksContentRange() {
+	data := []byte("0123456789abcdefghij")
+
+	serve := func(contentRange string, body []byte) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Range", contentRange)
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(body)
+		}))
+	}
+
+	for _, contentRange := range []string{"", "bytes 0-7/20", "bytes 12-19/20", "bytes 10-13/*", "bytes 10-13/30"} {
+		server := serve(contentRange, data[10:18])
+
+		_, err := rangeReaderAt{NewHTTPReaderAt(server.URL, server.Client())}.ReadAt(make([]byte, 8), 10)
+		suite.Equal(ErrUnexpectedRange, err, contentRange)
+
+		server.Close()
+	}
+
+	// a short range is accepted at the end of the file
+	server := serve("bytes 16-19/20", data[16:])
+	defer server.Close()
+
+	p := make([]byte, 8)
+	n, err := rangeReaderAt{NewHTTPReaderAt(server.URL, server.Client())}.ReadAt(p, 16)
+	suite.Equal(io.EOF, err)
+	suite.Equal("ghij", string(p[:n]))
+}
+
+func TestParseContentRange(t *testing.T) {
+	start, end, size, err := parseContentRange("bytes 10-19/100")
+	if start != 10 || end != 19 || size != 100 || err != nil {
+		t.Errorf("unexpected range %d-%d/%d, %v", start, end, size, err)
+	}
+
+	if _, _, size, err := parseContentRange("bytes 10-19/*"); size != -1 || err != nil {
+		t.Errorf("unknown size should be parsed, got %d, %v", size, err)
+	}
+
+	for _, value := range []string{"bytes 19-10/100", "bytes 10-100/100", "items 1-2/3", "bytes 1/3"} {
+		if _, _, _, err := parseContentRange(value); err != ErrUnexpectedRange {
+			t.Errorf("%q should be rejected, got %v", value, err)
+		}
+	}
+}
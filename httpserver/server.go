@@ -0,0 +1,467 @@
+// Package httpserver serves lookups in a constant database over HTTP, so it can be used from other languages.
+//
+// Endpoints:
+//
+//	GET  /v1/get/{key}     returns the first value of the key, 404 if there is no such key
+//	GET  /v1/get?key={key} is the same, the key is a query parameter
+//	HEAD /v1/get/{key}     tells if the key exists (200 or 404), ?key= works as well
+//	POST /v1/batch         returns values of several keys: {"keys": [...]} -> {"values": [... or null]}
+//	GET  /stats            returns counters of the server as JSON
+//	GET  /dump             streams all records as JSON lines: {"key": ..., "value": ...}
+//
+// Paths are cleaned by http.ServeMux, a request of a path with "//", "/./" or "/../" is redirected
+// to the cleaned one, so such keys have to be given in the key query parameter (or in base64).
+//
+// Keys and values are raw bytes by default (JSON strings in /v1/batch and /dump). With ?encoding=base64
+// keys are base64, padding is optional: URL-safe alphabet in URLs, standard or URL-safe one in batch requests.
+// Keys and values are returned in base64 then, which is the way to go for binary data.
+package httpserver
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alldroll/cdb"
+)
+
+const (
+	// Max size of a batch request body
+	maxBatchSize = 1 << 20
+	// Number of dumped records between flushes of the response
+	dumpFlushInterval = 1024
+)
+
+// Stats holds counters of a Server
+type Stats struct {
+	Records  int       `json:"records"`
+	Gets     int64     `json:"gets"`
+	Hits     int64     `json:"hits"`
+	Misses   int64     `json:"misses"`
+	Batches  int64     `json:"batches"`
+	Dumps    int64     `json:"dumps"`
+	Errors   int64     `json:"errors"`
+	Reloads  int64     `json:"reloads"`
+	LoadedAt time.Time `json:"loaded_at"`
+}
+
+// Server is an http.Handler which serves lookups in a database. The database can be replaced
+// while the server is running (see Swap and Reload), requests in flight finish with the old one.
+type Server struct {
+	mux *http.ServeMux
+
+	mu      sync.RWMutex
+	current *generation
+	handle  *cdb.CDB
+	path    string
+	// closed is set by Close, requests are not served after it
+	closed bool
+
+	gets, hits, misses, batches, dumps, errors, reloads atomic.Int64
+}
+
+// generation is a loaded database with the number of requests using it
+type generation struct {
+	reader   cdb.Reader
+	closer   io.Closer
+	loadedAt time.Time
+	requests sync.WaitGroup
+}
+
+// New returns a new Server over the given reader
+func New(reader cdb.Reader) *Server {
+	s := &Server{
+		mux:     http.NewServeMux(),
+		current: &generation{reader: reader, loadedAt: time.Now()},
+	}
+
+	s.mux.HandleFunc("GET /v1/get", s.get)
+	s.mux.HandleFunc("GET /v1/get/{key...}", s.get)
+	s.mux.HandleFunc("POST /v1/batch", s.batch)
+	s.mux.HandleFunc("GET /stats", s.stats)
+	s.mux.HandleFunc("GET /dump", s.dump)
+
+	return s
+}
+
+// Open returns a new Server over the database file, which is opened by the given handle.
+// Reload opens the file again.
+func Open(handle *cdb.CDB, path string) (*Server, error) {
+	reader, f, err := open(handle, path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := New(reader)
+	s.current.closer = f
+	s.handle, s.path = handle, path
+
+	return s, nil
+}
+
+// open opens the database file
+func open(handle *cdb.CDB, path string) (cdb.Reader, *os.File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reader, err := handle.GetReader(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	return reader, f, nil
+}
+
+// Reload opens the database file given to Open again and swaps it in, e.g. after the file was replaced.
+// If the file can not be read, the server keeps the current database.
+func (s *Server) Reload() error {
+	reader, f, err := open(s.handle, s.path)
+	if err != nil {
+		return err
+	}
+
+	s.Swap(reader, f)
+
+	return nil
+}
+
+// Swap replaces the database with the given reader. The closer (if not nil) is closed when the reader
+// is swapped out and all requests using it are done, or right away if the server is closed.
+func (s *Server) Swap(reader cdb.Reader, closer io.Closer) {
+	s.mu.Lock()
+
+	if s.closed {
+		s.mu.Unlock()
+
+		if closer != nil {
+			closer.Close()
+		}
+
+		return
+	}
+
+	old := s.current
+	s.current = &generation{reader: reader, closer: closer, loadedAt: time.Now()}
+	s.mu.Unlock()
+
+	s.reloads.Add(1)
+
+	go func() {
+		old.requests.Wait()
+
+		if old.closer != nil {
+			old.closer.Close()
+		}
+	}()
+}
+
+// Close closes the current database after requests in flight are done, new requests are rejected
+// with 503 Service Unavailable
+func (s *Server) Close() error {
+	s.mu.Lock()
+
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+
+	// no request is added to the generation after it is marked closed, so waiting is safe
+	s.closed = true
+	current := s.current
+	s.mu.Unlock()
+
+	current.requests.Wait()
+
+	if current.closer != nil {
+		return current.closer.Close()
+	}
+
+	return nil
+}
+
+// Stats returns counters of the server, Records and LoadedAt are zero after Close
+func (s *Server) Stats() Stats {
+	stats := Stats{
+		Gets:    s.gets.Load(),
+		Hits:    s.hits.Load(),
+		Misses:  s.misses.Load(),
+		Batches: s.batches.Load(),
+		Dumps:   s.dumps.Load(),
+		Errors:  s.errors.Load(),
+		Reloads: s.reloads.Load(),
+	}
+
+	if g := s.acquire(); g != nil {
+		defer g.requests.Done()
+
+		stats.Records, stats.LoadedAt = g.reader.Size(), g.loadedAt
+	}
+
+	return stats
+}
+
+// ServeHTTP implements http.Handler interface
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// acquire returns the current database, the caller must call requests.Done when it is not used anymore.
+// Returns nil if the server is closed.
+func (s *Server) acquire() *generation {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return nil
+	}
+
+	s.current.requests.Add(1)
+
+	return s.current
+}
+
+// get serves GET and HEAD /v1/get/{key} and /v1/get?key={key}
+func (s *Server) get(w http.ResponseWriter, r *http.Request) {
+	g := s.acquire()
+	if g == nil {
+		s.fail(w, "server is closed", http.StatusServiceUnavailable)
+		return
+	}
+
+	defer g.requests.Done()
+
+	s.gets.Add(1)
+
+	encoded := useBase64(r)
+
+	text := r.PathValue("key")
+
+	if r.URL.Path == "/v1/get" {
+		query := r.URL.Query()
+		if !query.Has("key") {
+			s.fail(w, "missing key parameter", http.StatusBadRequest)
+			return
+		}
+
+		text = query.Get("key")
+	}
+
+	key, err := decodeKey(text, encoded)
+	if err != nil {
+		s.fail(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == http.MethodHead {
+		found, err := g.reader.HasContext(r.Context(), key)
+		if err != nil {
+			s.fail(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if !found {
+			s.misses.Add(1)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		s.hits.Add(1)
+		w.WriteHeader(http.StatusOK)
+
+		return
+	}
+
+	value, err := g.reader.GetContext(r.Context(), key)
+	if err == cdb.ErrEntryNotFound {
+		s.misses.Add(1)
+		http.Error(w, "key not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		s.fail(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.hits.Add(1)
+
+	if encoded {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.WriteString(w, base64.StdEncoding.EncodeToString(value))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(value)
+}
+
+// batchRequest is a body of POST /v1/batch
+type batchRequest struct {
+	Keys []string `json:"keys"`
+}
+
+// batchResponse is a response of POST /v1/batch, values are in the order of keys, null for missing ones
+type batchResponse struct {
+	Values []*string `json:"values"`
+}
+
+// batch serves POST /v1/batch
+func (s *Server) batch(w http.ResponseWriter, r *http.Request) {
+	g := s.acquire()
+	if g == nil {
+		s.fail(w, "server is closed", http.StatusServiceUnavailable)
+		return
+	}
+
+	defer g.requests.Done()
+
+	s.batches.Add(1)
+
+	var request batchRequest
+
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBatchSize)).Decode(&request); err != nil {
+		s.fail(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	encoded := useBase64(r)
+	response := batchResponse{Values: make([]*string, len(request.Keys))}
+
+	for i, k := range request.Keys {
+		key, err := decodeBatchKey(k, encoded)
+		if err != nil {
+			s.fail(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		value, err := g.reader.GetContext(r.Context(), key)
+		if err == cdb.ErrEntryNotFound {
+			s.misses.Add(1)
+			continue
+		}
+
+		if err != nil {
+			s.fail(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		s.hits.Add(1)
+		text := encodeValue(value, encoded)
+		response.Values[i] = &text
+	}
+
+	writeJSON(w, response)
+}
+
+// stats serves GET /stats
+func (s *Server) stats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.Stats())
+}
+
+// dumpRecord is a line of GET /dump
+type dumpRecord struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// dump serves GET /dump, the response is aborted if a read fails in the middle
+func (s *Server) dump(w http.ResponseWriter, r *http.Request) {
+	g := s.acquire()
+	if g == nil {
+		s.fail(w, "server is closed", http.StatusServiceUnavailable)
+		return
+	}
+
+	defer g.requests.Done()
+
+	s.dumps.Add(1)
+
+	encoded := useBase64(r)
+	flusher, _ := w.(http.Flusher)
+	buffer := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buffer)
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+
+	count := 0
+
+	for key, value := range g.reader.All() {
+		if r.Context().Err() != nil {
+			return
+		}
+
+		record := dumpRecord{Key: encodeValue(key, encoded), Value: encodeValue(value, encoded)}
+
+		if err := encoder.Encode(record); err != nil {
+			return
+		}
+
+		if count++; count%dumpFlushInterval == 0 && flusher != nil {
+			buffer.Flush()
+			flusher.Flush()
+		}
+	}
+
+	// a read error can not be reported after the status, so the response is aborted
+	if g.reader.Err() != nil {
+		s.errors.Add(1)
+		panic(http.ErrAbortHandler)
+	}
+
+	buffer.Flush()
+}
+
+// fail counts the error and replies with it
+func (s *Server) fail(w http.ResponseWriter, message string, code int) {
+	s.errors.Add(1)
+	http.Error(w, message, code)
+}
+
+// useBase64 tells if keys and values of the request are base64 encoded
+func useBase64(r *http.Request) bool {
+	return r.URL.Query().Get("encoding") == "base64"
+}
+
+// decodeKey returns the key given in the URL of a request, base64 keys use the URL-safe alphabet:
+// "/" of the standard one would be a path separator
+func decodeKey(key string, encoded bool) ([]byte, error) {
+	if !encoded {
+		return []byte(key), nil
+	}
+
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(key, "="))
+}
+
+// decodeBatchKey returns a key given in a batch request, base64 keys use the standard or URL-safe alphabet
+func decodeBatchKey(key string, encoded bool) ([]byte, error) {
+	if encoded && !strings.ContainsAny(key, "-_") {
+		return base64.RawStdEncoding.DecodeString(strings.TrimRight(key, "="))
+	}
+
+	return decodeKey(key, encoded)
+}
+
+// encodeValue returns the value as a string of a response
+func encodeValue(value []byte, encoded bool) string {
+	if encoded {
+		return base64.StdEncoding.EncodeToString(value)
+	}
+
+	return string(value)
+}
+
+// writeJSON replies with the given value as JSON
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
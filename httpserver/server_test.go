@@ -0,0 +1,253 @@
+package httpserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alldroll/cdb"
+	"github.com/stretchr/testify/suite"
+)
+
+type ServerTestSuite struct {
+	suite.Suite
+	path       string
+	server     *Server
+	httpServer *httptest.Server
+}
+
+// writeDB writes the given records into the database file
+func (suite *ServerTestSuite) writeDB(records map[string]string) {
+	f, err := os.Create(suite.path)
+	suite.Require().Nil(err)
+	defer f.Close()
+
+	writer, err := cdb.New().GetWriter(f)
+	suite.Require().Nil(err)
+
+	for key, value := range records {
+		suite.Require().Nil(writer.Put([]byte(key), []byte(value)))
+	}
+
+	suite.Require().Nil(writer.Close())
+}
+
+func (suite *ServerTestSuite) SetupTest() {
+	suite.path = filepath.Join(suite.T().TempDir(), "test.cdb")
+	suite.writeDB(map[string]string{
+		"key":      "value",
+		"dir/key":  "nested",
+		"\x00\xff": "binary",
+	})
+
+	server, err := Open(cdb.New(), suite.path)
+	suite.Require().Nil(err)
+
+	suite.server = server
+	suite.httpServer = httptest.NewServer(server)
+}
+
+func (suite *ServerTestSuite) TearDownTest() {
+	suite.httpServer.Close()
+	suite.Nil(suite.server.Close())
+}
+
+// request sends a request and returns the status and the body of the response
+func (suite *ServerTestSuite) request(method, path string, body io.Reader) (int, string) {
+	req, err := http.NewRequest(method, suite.httpServer.URL+path, body)
+	suite.Require().Nil(err)
+
+	resp, err := http.DefaultClient.Do(req)
+	suite.Require().Nil(err)
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	suite.Require().Nil(err)
+
+	return resp.StatusCode, string(data)
+}
+
+func (suite *ServerTestSuite) TestGet() {
+	status, body := suite.request("GET", "/v1/get/key", nil)
+	suite.Equal(http.StatusOK, status)
+	suite.Equal("value", body)
+
+	status, body = suite.request("GET", "/v1/get/dir/key", nil)
+	suite.Equal(http.StatusOK, status)
+	suite.Equal("nested", body)
+
+	status, _ = suite.request("GET", "/v1/get/missing", nil)
+	suite.Equal(http.StatusNotFound, status)
+}
+
+func (suite *ServerTestSuite) TestGetBase64() {
+	key := base64.RawURLEncoding.EncodeToString([]byte("\x00\xff"))
+
+	status, body := suite.request("GET", "/v1/get/"+key+"?encoding=base64", nil)
+	suite.Equal(http.StatusOK, status)
+	suite.Equal(base64.StdEncoding.EncodeToString([]byte("binary")), body)
+
+	status, _ = suite.request("GET", "/v1/get/!!!?encoding=base64", nil)
+	suite.Equal(http.StatusBadRequest, status)
+}
+
+func (suite *ServerTestSuite) TestGetKeysChangedByPathCleaning() {
+	records := map[string]string{
+		"a//b":         "double slash",
+		"a/./b":        "dot",
+		"a/../b":       "dot dot",
+		"/rooted":      "leading slash",
+		"\xff\xff\xff": "slashes in standard base64",
+	}
+
+	suite.writeDB(records)
+	suite.Require().Nil(suite.server.Reload())
+
+	for key, value := range records {
+		status, body := suite.request("GET", "/v1/get?key="+url.QueryEscape(key), nil)
+		suite.Equal(http.StatusOK, status, key)
+		suite.Equal(value, body, key)
+
+		status, _ = suite.request("HEAD", "/v1/get?key="+url.QueryEscape(key), nil)
+		suite.Equal(http.StatusOK, status, key)
+
+		status, body = suite.request("GET", "/v1/get/"+base64.RawURLEncoding.EncodeToString([]byte(key))+"?encoding=base64", nil)
+		suite.Equal(http.StatusOK, status, key)
+		suite.Equal(base64.StdEncoding.EncodeToString([]byte(value)), body, key)
+	}
+
+	// "////" is "\xff\xff\xff" in standard base64, the path would be cleaned, so it is rejected
+	status, body := suite.request("GET", "/v1/get/////?encoding=base64", nil)
+	suite.NotEqual(base64.StdEncoding.EncodeToString([]byte(records["\xff\xff\xff"])), body)
+	suite.NotEqual(http.StatusOK, status)
+
+	status, _ = suite.request("GET", "/v1/get?encoding=base64&key=____", nil)
+	suite.Equal(http.StatusOK, status)
+
+	status, _ = suite.request("GET", "/v1/get", nil)
+	suite.Equal(http.StatusBadRequest, status)
+
+	// batch requests carry keys in the body, so the standard alphabet is fine there
+	status, body = suite.request("POST", "/v1/batch?encoding=base64", bytes.NewBufferString(`{"keys": ["////"]}`))
+	suite.Require().Equal(http.StatusOK, status)
+	suite.Contains(body, base64.StdEncoding.EncodeToString([]byte(records["\xff\xff\xff"])))
+}
+
+func (suite *ServerTestSuite) TestHead() {
+	status, body := suite.request("HEAD", "/v1/get/key", nil)
+	suite.Equal(http.StatusOK, status)
+	suite.Empty(body)
+
+	status, _ = suite.request("HEAD", "/v1/get/missing", nil)
+	suite.Equal(http.StatusNotFound, status)
+}
+
+func (suite *ServerTestSuite) TestBatch() {
+	status, body := suite.request("POST", "/v1/batch", bytes.NewBufferString(`{"keys": ["key", "missing", "dir/key"]}`))
+	suite.Require().Equal(http.StatusOK, status)
+
+	var response batchResponse
+	suite.Require().Nil(json.Unmarshal([]byte(body), &response))
+	suite.Require().Len(response.Values, 3)
+	suite.Equal("value", *response.Values[0])
+	suite.Nil(response.Values[1])
+	suite.Equal("nested", *response.Values[2])
+
+	status, _ = suite.request("POST", "/v1/batch", bytes.NewBufferString(`{"keys": `))
+	suite.Equal(http.StatusBadRequest, status)
+}
+
+func (suite *ServerTestSuite) TestDump() {
+	status, body := suite.request("GET", "/dump?encoding=base64", nil)
+	suite.Require().Equal(http.StatusOK, status)
+
+	records := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewBufferString(body))
+
+	for scanner.Scan() {
+		var record dumpRecord
+		suite.Require().Nil(json.Unmarshal(scanner.Bytes(), &record))
+
+		key, err := base64.StdEncoding.DecodeString(record.Key)
+		suite.Require().Nil(err)
+		value, err := base64.StdEncoding.DecodeString(record.Value)
+		suite.Require().Nil(err)
+
+		records[string(key)] = string(value)
+	}
+
+	suite.Equal(map[string]string{"key": "value", "dir/key": "nested", "\x00\xff": "binary"}, records)
+}
+
+func (suite *ServerTestSuite) TestStats() {
+	suite.request("GET", "/v1/get/key", nil)
+	suite.request("GET", "/v1/get/missing", nil)
+
+	status, body := suite.request("GET", "/stats", nil)
+	suite.Require().Equal(http.StatusOK, status)
+
+	var stats Stats
+	suite.Require().Nil(json.Unmarshal([]byte(body), &stats))
+	suite.Equal(3, stats.Records)
+	suite.Equal(int64(2), stats.Gets)
+	suite.Equal(int64(1), stats.Hits)
+	suite.Equal(int64(1), stats.Misses)
+}
+
+func (suite *ServerTestSuite) TestReload() {
+	// the file is replaced, the old one stays readable until it is closed
+	suite.Require().Nil(os.Rename(suite.path, suite.path+".old"))
+	suite.writeDB(map[string]string{"key": "new value"})
+	suite.Require().Nil(suite.server.Reload())
+
+	status, body := suite.request("GET", "/v1/get/key", nil)
+	suite.Equal(http.StatusOK, status)
+	suite.Equal("new value", body)
+	suite.Equal(int64(1), suite.server.Stats().Reloads)
+
+	suite.Require().Nil(os.Remove(suite.path))
+	suite.NotNil(suite.server.Reload(), "a failed reload should keep the current database")
+
+	status, _ = suite.request("GET", "/v1/get/key", nil)
+	suite.Equal(http.StatusOK, status)
+}
+
+// closeCounter counts Close calls
+type closeCounter struct {
+	closed int
+}
+
+func (c *closeCounter) Close() error {
+	c.closed++
+	return nil
+}
+
+func (suite *ServerTestSuite) TestClose() {
+	suite.Require().Nil(suite.server.Close())
+
+	for _, path := range []string{"/v1/get/key", "/dump"} {
+		status, _ := suite.request("GET", path, nil)
+		suite.Equal(http.StatusServiceUnavailable, status, path)
+	}
+
+	status, _ := suite.request("POST", "/v1/batch", bytes.NewBufferString(`{"keys": ["key"]}`))
+	suite.Equal(http.StatusServiceUnavailable, status)
+	suite.Zero(suite.server.Stats().Records)
+
+	// a database swapped in after Close is closed right away
+	closer := &closeCounter{}
+	suite.server.Swap(nil, closer)
+	suite.Equal(1, closer.closed)
+}
+
+func TestServerTestSuite(t *testing.T) {
+	suite.Run(t, new(ServerTestSuite))
+}
@@ -0,0 +1,204 @@
+package cdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// The index section holds positions of records (4 bytes each) sorted by key, records of equal keys
+// are kept in file order. Reader finds the first key of a range by binary search over the positions,
+// then reads records one by one, so the index costs 4 bytes per record and is not loaded into memory.
+
+// ErrNoIndex tells that the database was built without the sorted key index, see CDB.SetIndex
+var ErrNoIndex = errors.New("cdb has no key index")
+
+// buildIndex merges sorted keys of records and returns the payload of the index section.
+// Only the last record of a key is kept if duplicates are replaced, since the others can not be found by Get.
+func (w *writerImpl) buildIndex() ([]byte, error) {
+	var (
+		data = make([]byte, 0, 4*w.records)
+		last []byte
+		seen bool
+	)
+
+	err := w.index.merge(func(rec *sortRecord) error {
+		if seen && w.duplicates == ReplaceDuplicates && bytes.Equal(last, rec.key) {
+			data = data[:len(data)-4]
+		}
+
+		data = appendUint32(data, uint32(rec.seq))
+		last, seen = append(last[:0], rec.key...), true
+
+		return nil
+	})
+
+	return data, err
+}
+
+// Scan returns a new Iterator object that yields records with keys in [start, end) in lexicographic order.
+// Nil start means the first key, nil end means there is no upper bound. Returns nil if there are no such keys.
+func (r *readerImpl) Scan(start, end []byte) (Iterator, error) {
+	if err := r.loadTrailer(); err != nil {
+		return nil, err
+	}
+
+	index, ok := r.sections[indexSection]
+	if !ok {
+		return nil, ErrNoIndex
+	}
+
+	reader := r.bind(context.Background())
+	from, to := 0, int(index.size/4)
+
+	var err error
+
+	if start != nil {
+		if from, err = r.lowerBound(reader, index, start); err != nil {
+			return nil, err
+		}
+	}
+
+	if end != nil {
+		if to, err = r.lowerBound(reader, index, end); err != nil {
+			return nil, err
+		}
+	}
+
+	if from >= to {
+		return nil, nil
+	}
+
+	iterator := &indexIterator{
+		reader:    reader,
+		cdbReader: r,
+		index:     index,
+		next:      from,
+		end:       to,
+		record: &record{
+			keySectionFactory:   &sectionReaderFactory{reader: reader},
+			valueSectionFactory: &sectionReaderFactory{reader: reader},
+		},
+	}
+
+	if _, err := iterator.Next(); err != nil {
+		return nil, err
+	}
+
+	return iterator, nil
+}
+
+// Prefix returns a new Iterator object that yields records which keys start with the given prefix
+// in lexicographic order. Returns nil if there are no such keys.
+func (r *readerImpl) Prefix(prefix []byte) (Iterator, error) {
+	return r.Scan(prefix, prefixEnd(prefix))
+}
+
+// lowerBound returns the number of the first index entry which key is not less than the given key
+func (r *readerImpl) lowerBound(reader io.ReaderAt, index section, key []byte) (int, error) {
+	lo, hi := 0, int(index.size/4)
+
+	for lo < hi {
+		mid := int(uint(lo+hi) >> 1)
+
+		position, err := r.indexEntry(reader, index, mid)
+		if err != nil {
+			return 0, err
+		}
+
+		var keySize, valSize uint32
+
+		if err := r.readPair(reader, position, &keySize, &valSize); err != nil {
+			return 0, err
+		}
+
+		midKey, err := readSection(reader, int64(position)+8, keySize)
+		if err != nil {
+			return 0, err
+		}
+
+		if bytes.Compare(midKey, key) < 0 {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+
+	return lo, nil
+}
+
+// indexEntry returns the position of the record of the i-th index entry
+func (r *readerImpl) indexEntry(reader io.ReaderAt, index section, i int) (uint32, error) {
+	data, err := readSection(reader, index.position+int64(i)*4, 4)
+	if err != nil {
+		return 0, err
+	}
+
+	return binary.LittleEndian.Uint32(data), nil
+}
+
+// prefixEnd returns the least key which is greater than all keys with the given prefix,
+// nil if there is no such key
+func prefixEnd(prefix []byte) []byte {
+	end := append([]byte(nil), prefix...)
+
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+
+	return nil
+}
+
+// indexIterator implements Iterator interface, it yields records of index entries [next, end)
+type indexIterator struct {
+	reader    io.ReaderAt
+	cdbReader *readerImpl
+	index     section
+	next, end int
+	record    *record
+}
+
+// Next moves the iterator to the next record. Returns true on success otherwise returns false.
+func (i *indexIterator) Next() (bool, error) {
+	if !i.HasNext() {
+		return false, nil
+	}
+
+	position, err := i.cdbReader.indexEntry(i.reader, i.index, i.next)
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := i.record.load(i.cdbReader, i.reader, position); err != nil {
+		return false, err
+	}
+
+	i.next++
+
+	return true, nil
+}
+
+// HasNext tells if the iterator can be moved to the next record.
+func (i *indexIterator) HasNext() bool {
+	return i.next < i.end
+}
+
+// Key returns key's []byte slice.
+func (i *indexIterator) Key() ([]byte, error) {
+	return i.record.key()
+}
+
+// Value returns values's []byte slice.
+func (i *indexIterator) Value() ([]byte, error) {
+	return i.record.value()
+}
+
+// Record returns copy of current record
+func (i *indexIterator) Record() Record {
+	return i.record.copy()
+}
@@ -0,0 +1,152 @@
+package cdb
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+)
+
+func (suite *CDBTestSuite) collectKeys(iterator Iterator) []string {
+	var keys []string
+
+	if iterator == nil {
+		return nil
+	}
+
+	for {
+		key, err := iterator.Key()
+		suite.Require().Nil(err)
+		keys = append(keys, string(key))
+
+		ok, err := iterator.Next()
+		suite.Require().Nil(err)
+
+		if !ok {
+			return keys
+		}
+	}
+}
+
+func (suite *CDBTestSuite) fillIndexedCDB() {
+	suite.testRecords = nil
+
+	for _, key := range []string{"b", "ab", "abc", "a", "c", "abd", "b"} {
+		suite.testRecords = append(suite.testRecords, testCDBRecord{
+			key: []byte(key),
+			val: []byte("val" + key),
+		})
+	}
+
+	suite.cdbHandle.SetIndex(true)
+	suite.fillTestCDB()
+}
+
+func (suite *CDBTestSuite) TestScan() {
+	suite.fillIndexedCDB()
+	reader := suite.getCDBReader()
+
+	cases := []struct {
+		start, end []byte
+		expected   []string
+	}{
+		{nil, nil, []string{"a", "ab", "abc", "abd", "b", "b", "c"}},
+		{[]byte("ab"), []byte("b"), []string{"ab", "abc", "abd"}},
+		{[]byte("aa"), []byte("abd"), []string{"ab", "abc"}},
+		{[]byte("b"), nil, []string{"b", "b", "c"}},
+		{nil, []byte("ab"), []string{"a"}},
+		{[]byte("d"), nil, nil},
+		{[]byte("b"), []byte("a"), nil},
+	}
+
+	for _, c := range cases {
+		iterator, err := reader.Scan(c.start, c.end)
+		suite.Require().Nil(err)
+		suite.Equal(c.expected, suite.collectKeys(iterator), "scan [%s, %s)", c.start, c.end)
+	}
+
+	iterator, err := reader.Scan([]byte("ab"), nil)
+	suite.Require().Nil(err)
+
+	value, err := iterator.Value()
+	suite.Nil(err)
+	suite.Equal([]byte("valab"), value)
+}
+
+func (suite *CDBTestSuite) TestPrefix() {
+	suite.fillIndexedCDB()
+	reader := suite.getCDBReader()
+
+	cases := map[string][]string{
+		"":    {"a", "ab", "abc", "abd", "b", "b", "c"},
+		"ab":  {"ab", "abc", "abd"},
+		"abc": {"abc"},
+		"b":   {"b", "b"},
+		"x":   nil,
+	}
+
+	for prefix, expected := range cases {
+		iterator, err := reader.Prefix([]byte(prefix))
+		suite.Require().Nil(err)
+		suite.Equal(expected, suite.collectKeys(iterator), "prefix %q", prefix)
+	}
+}
+
+func (suite *CDBTestSuite) TestIndexWithReplacedDuplicates() {
+	suite.cdbHandle.SetDuplicates(ReplaceDuplicates)
+	suite.fillIndexedCDB()
+
+	iterator, err := suite.getCDBReader().Prefix([]byte("b"))
+	suite.Require().Nil(err)
+	suite.Equal([]string{"b"}, suite.collectKeys(iterator))
+}
+
+func (suite *CDBTestSuite) TestIndexInParallel() {
+	for i := 0; i < 1000; i++ {
+		stri := strconv.Itoa(i)
+		suite.testRecords = append(suite.testRecords, testCDBRecord{
+			key: []byte("item" + stri),
+			val: []byte("val" + stri),
+		})
+	}
+
+	suite.cdbHandle.SetIndex(true)
+	suite.fillTestCDBInParallel(0)
+
+	iterator, err := suite.getCDBReader().Prefix([]byte("item99"))
+	suite.Require().Nil(err)
+	suite.Equal([]string{"item99", "item990", "item991", "item992", "item993", "item994", "item995",
+		"item996", "item997", "item998", "item999"}, suite.collectKeys(iterator))
+}
+
+func (suite *CDBTestSuite) TestScanWithoutIndex() {
+	suite.fillTestCDB()
+
+	_, err := suite.getCDBReader().Scan(nil, nil)
+	suite.Equal(ErrNoIndex, err)
+}
+
+func (suite *CDBTestSuite) TestScanOnEmptyDataSet() {
+	suite.testRecords = nil
+	suite.cdbHandle.SetIndex(true)
+	suite.fillTestCDB()
+
+	iterator, err := suite.getCDBReader().Scan(nil, nil)
+	suite.Nil(err)
+	suite.Nil(iterator)
+}
+
+func TestPrefixEnd(t *testing.T) {
+	cases := map[string][]byte{
+		"":           nil,
+		"a":          []byte("b"),
+		"a\xff":      []byte("b"),
+		"\xff\xff":   nil,
+		"ab\xfe\xff": []byte("ab\xff"),
+	}
+
+	for prefix, expected := range cases {
+		if end := prefixEnd([]byte(prefix)); !bytes.Equal(end, expected) || (end == nil) != (expected == nil) {
+			t.Errorf("prefixEnd(%q) = %q, expected %q", prefix, end, expected)
+		}
+	}
+}
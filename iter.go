@@ -0,0 +1,123 @@
+package cdb
+
+import "iter"
+
+// The methods below adapt the reader to range-over-func loops. A read error stops the loop and is kept
+// by the reader, so Err has to be checked after the loop:
+//
+//	for key, value := range reader.All() {
+//		...
+//	}
+//	if err := reader.Err(); err != nil {
+//		...
+//	}
+//
+// Only the first error is kept: a reader which failed to read its file should be reopened.
+// All and Keys walk the file, so they yield every stored record of a key: all of them with AllowDuplicates,
+// and also records superseded with ReplaceDuplicates, which Get does not return anymore.
+
+// All returns a sequence of all records in file order. Keys and values are new slices.
+func (r *readerImpl) All() iter.Seq2[[]byte, []byte] {
+	return func(yield func(key, value []byte) bool) {
+		r.walk(true, func(key, value []byte, err error) bool {
+			if err != nil {
+				r.setErr(err)
+				return false
+			}
+
+			return yield(key, value)
+		})
+	}
+}
+
+// Keys returns a sequence of keys of all records in file order.
+func (r *readerImpl) Keys() iter.Seq[[]byte] {
+	return func(yield func(key []byte) bool) {
+		r.walk(false, func(key, _ []byte, err error) bool {
+			if err != nil {
+				r.setErr(err)
+				return false
+			}
+
+			return yield(key)
+		})
+	}
+}
+
+// ValuesFor returns a sequence of all values associated with the given key in the order of Put calls.
+func (r *readerImpl) ValuesFor(key []byte) iter.Seq[[]byte] {
+	return func(yield func(value []byte) bool) {
+		if err := r.readValues(key, yield); err != nil {
+			r.setErr(err)
+		}
+	}
+}
+
+// Err returns the first error which stopped a sequence of All, Keys or ValuesFor, nil if there was none.
+func (r *readerImpl) Err() error {
+	r.seqMu.Lock()
+	defer r.seqMu.Unlock()
+
+	return r.seqErr
+}
+
+// setErr keeps the given error if there is no error yet
+func (r *readerImpl) setErr(err error) {
+	r.seqMu.Lock()
+	defer r.seqMu.Unlock()
+
+	if r.seqErr == nil {
+		r.seqErr = err
+	}
+}
+
+// readValues calls fn for each value associated with the given key until fn returns false, returns a read error
+func (r *readerImpl) readValues(key []byte, fn func(value []byte) bool) error {
+	var readErr error
+
+	findErr := r.findEntries(r.reader, key, func(entry *sectionReaderFactory) bool {
+		value, err := readSection(entry.reader, int64(entry.position), entry.size)
+		if err != nil {
+			readErr = err
+			return false
+		}
+
+		return fn(value)
+	})
+
+	if findErr != nil {
+		return findErr
+	}
+
+	return readErr
+}
+
+// walk calls fn for each record in file order until fn returns false, values are read only if withValues is set.
+// A read error is passed to fn and stops the walk.
+func (r *readerImpl) walk(withValues bool, fn func(key, value []byte, err error) bool) {
+	for position := uint32(tablesRefsSize); position < r.endPos; {
+		var keySize, valSize uint32
+
+		if err := r.readPair(r.reader, position, &keySize, &valSize); err != nil {
+			fn(nil, nil, err)
+			return
+		}
+
+		size := keySize
+		if withValues {
+			size += valSize
+		}
+
+		data, err := readSection(r.reader, int64(position)+8, size)
+		if err != nil {
+			fn(nil, nil, err)
+			return
+		}
+
+		if !fn(data[:keySize:keySize], data[keySize:], nil) {
+			return
+		}
+
+		position += 8 + keySize + valSize
+	}
+}
@@ -0,0 +1,156 @@
+package cdb
+
+import (
+	"errors"
+	"io"
+)
+
+func (suite *CDBTestSuite) TestAll() {
+	suite.fillTestCDB()
+
+	i := 0
+
+	reader := suite.getCDBReader()
+
+	for key, value := range reader.All() {
+		suite.Equal(suite.testRecords[i].key, key)
+		suite.Equal(suite.testRecords[i].val, value)
+		i++
+	}
+
+	suite.Nil(reader.Err())
+	suite.Equal(len(suite.testRecords), i)
+}
+
+func (suite *CDBTestSuite) TestAllBreak() {
+	suite.fillTestCDB()
+
+	var keys [][]byte
+
+	for key := range suite.getCDBReader().All() {
+		keys = append(keys, key)
+
+		if len(keys) == 3 {
+			break
+		}
+	}
+
+	suite.Len(keys, 3)
+}
+
+func (suite *CDBTestSuite) TestAllOnEmptyDataSet() {
+	suite.testRecords = nil
+	suite.fillTestCDB()
+
+	for range suite.getCDBReader().All() {
+		suite.Fail("an empty database should yield nothing")
+	}
+}
+
+func (suite *CDBTestSuite) TestKeys() {
+	suite.fillTestCDB()
+
+	var keys [][]byte
+
+	reader := suite.getCDBReader()
+
+	for key := range reader.Keys() {
+		keys = append(keys, key)
+	}
+
+	suite.Nil(reader.Err())
+	suite.Len(keys, len(suite.testRecords))
+
+	for i, rec := range suite.testRecords {
+		suite.Equal(rec.key, keys[i])
+	}
+}
+
+func (suite *CDBTestSuite) TestValuesFor() {
+	writer := suite.getCDBWriter()
+	suite.Require().Nil(writer.Put([]byte("key"), []byte("1")))
+	suite.Require().Nil(writer.Put([]byte("other"), []byte("0")))
+	suite.Require().Nil(writer.Put([]byte("key"), []byte("2")))
+	suite.Require().Nil(writer.Close())
+
+	reader := suite.getCDBReader()
+
+	var values []string
+
+	for value := range reader.ValuesFor([]byte("key")) {
+		values = append(values, string(value))
+	}
+
+	suite.Nil(reader.Err())
+	suite.Equal([]string{"1", "2"}, values)
+
+	for range reader.ValuesFor([]byte("missing")) {
+		suite.Fail("there are no values of a missing key")
+	}
+}
+
+func (suite *CDBTestSuite) TestAllReportsReadErrors() {
+	suite.fillTestCDB()
+
+	failure := errors.New("read failure")
+	reader, err := suite.cdbHandle.GetReader(&failingReaderAt{
+		reader: suite.cdbFile,
+		from:   tablesRefsSize + 16,
+		to:     tablesRefsSize + 32,
+		err:    failure,
+	})
+	suite.Require().Nil(err)
+
+	count := 0
+
+	for range reader.All() {
+		count++
+	}
+
+	suite.Equal(1, count, "a read error should stop the loop")
+	suite.Equal(failure, reader.Err())
+
+	// the first error is kept
+	for range reader.ValuesFor([]byte("missing")) {
+	}
+
+	suite.Equal(failure, reader.Err())
+}
+
+func (suite *CDBTestSuite) TestAllYieldsReplacedRecords() {
+	suite.cdbHandle.SetDuplicates(ReplaceDuplicates)
+
+	writer := suite.getCDBWriter()
+	suite.Require().Nil(writer.Put([]byte("key"), []byte("1")))
+	suite.Require().Nil(writer.Put([]byte("key"), []byte("2")))
+	suite.Require().Nil(writer.Close())
+
+	reader := suite.getCDBReader()
+
+	var values []string
+
+	for _, value := range reader.All() {
+		values = append(values, string(value))
+	}
+
+	suite.Equal([]string{"1", "2"}, values, "a superseded record stays in the file")
+
+	value, err := reader.Get([]byte("key"))
+	suite.Nil(err)
+	suite.Equal([]byte("2"), value)
+}
+
+// failingReaderAt fails reads in [from, to)
+type failingReaderAt struct {
+	reader   io.ReaderAt
+	from, to int64
+	err      error
+}
+
+func (f *failingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off >= f.from && off < f.to {
+		return 0, f.err
+	}
+
+	return f.reader.ReadAt(p, off)
+}
@@ -9,6 +9,7 @@ var ErrEmptyCDB = errors.New("cdb is empty")
 
 // iterator implements Iterator interface
 type iterator struct {
+	reader    io.ReaderAt
 	position  uint32
 	cdbReader *readerImpl
 	record    *record
@@ -50,19 +51,12 @@ func (i *iterator) Next() (bool, error) {
 		return false, nil
 	}
 
-	var keySize, valSize uint32
-
-	if err := i.cdbReader.readPair(i.position, &keySize, &valSize); err != nil {
+	next, err := i.record.load(i.cdbReader, i.reader, i.position)
+	if err != nil {
 		return false, err
 	}
 
-	i.record.keySectionFactory.position = i.position + 8
-	i.record.keySectionFactory.size = keySize
-
-	i.record.valueSectionFactory.position = i.position + 8 + keySize
-	i.record.valueSectionFactory.size = valSize
-
-	i.position += keySize + valSize + 8
+	i.position = next
 
 	return true, nil
 }
@@ -70,31 +64,18 @@ func (i *iterator) Next() (bool, error) {
 // Key returns key's []byte slice. It is usually easier to use and
 // faster then iterator.Record().Key(). Because it doesn't requiers allocation for SectionReader
 func (i *iterator) Key() ([]byte, error) {
-	keyFactory := i.record.keySectionFactory
-	return readSection(keyFactory.reader, int64(keyFactory.position), keyFactory.size)
+	return i.record.key()
 }
 
 // Value returns values's []byte slice. It is usually easier to use and
 // faster then iterator.Record().Value(). Because it doesn't requiers allocation for SectionReader
 func (i *iterator) Value() ([]byte, error) {
-	valueFactory := i.record.valueSectionFactory
-	return readSection(valueFactory.reader, int64(valueFactory.position), valueFactory.size)
+	return i.record.value()
 }
 
 // Record returns copy of current record
 func (i *iterator) Record() Record {
-	return &record{
-		keySectionFactory: &sectionReaderFactory{
-			reader:   i.record.keySectionFactory.reader,
-			position: i.record.keySectionFactory.position,
-			size:     i.record.keySectionFactory.size,
-		},
-		valueSectionFactory: &sectionReaderFactory{
-			reader:   i.record.valueSectionFactory.reader,
-			position: i.record.valueSectionFactory.position,
-			size:     i.record.valueSectionFactory.size,
-		},
-	}
+	return i.record.copy()
 }
 
 // HasNext tells if the iterator can be moved to the next record.
@@ -105,6 +86,49 @@ func (i *iterator) HasNext() bool {
 	return i.position < i.cdbReader.endPos
 }
 
+// load points the record to the one at the given position. Returns the position of the next record.
+func (r *record) load(cdbReader *readerImpl, reader io.ReaderAt, position uint32) (uint32, error) {
+	var keySize, valSize uint32
+
+	if err := cdbReader.readPair(reader, position, &keySize, &valSize); err != nil {
+		return 0, err
+	}
+
+	r.keySectionFactory.position = position + 8
+	r.keySectionFactory.size = keySize
+
+	r.valueSectionFactory.position = position + 8 + keySize
+	r.valueSectionFactory.size = valSize
+
+	return position + keySize + valSize + 8, nil
+}
+
+// key reads the key of the record
+func (r *record) key() ([]byte, error) {
+	return readSection(r.keySectionFactory.reader, int64(r.keySectionFactory.position), r.keySectionFactory.size)
+}
+
+// value reads the value of the record
+func (r *record) value() ([]byte, error) {
+	return readSection(r.valueSectionFactory.reader, int64(r.valueSectionFactory.position), r.valueSectionFactory.size)
+}
+
+// copy returns a copy of the record
+func (r *record) copy() *record {
+	return &record{
+		keySectionFactory: &sectionReaderFactory{
+			reader:   r.keySectionFactory.reader,
+			position: r.keySectionFactory.position,
+			size:     r.keySectionFactory.size,
+		},
+		valueSectionFactory: &sectionReaderFactory{
+			reader:   r.valueSectionFactory.reader,
+			position: r.valueSectionFactory.position,
+			size:     r.valueSectionFactory.size,
+		},
+	}
+}
+
 // Key returns io.Reader with given record's key and key size.
 func (r *record) Key() (io.Reader, uint32) {
 	return r.keySectionFactory.create()
@@ -0,0 +1,181 @@
+package kvserver
+
+import (
+	"bufio"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/alldroll/cdb"
+)
+
+const (
+	// Max length of a memcached key
+	maxKeyLen = 250
+	// Max size of a data block of a memcached storage command
+	maxDataSize = 1 << 20
+)
+
+// serveMemcached handles memcached text commands until the client quits or the connection fails
+func serveMemcached(reader cdb.Reader, r *bufio.Reader, w *bufio.Writer) error {
+	for {
+		line, err := readLine(r)
+		if err == errProtocol {
+			w.WriteString("CLIENT_ERROR line too long\r\n")
+			return err
+		}
+
+		if err != nil {
+			return err
+		}
+
+		quit, err := handleMemcached(reader, strings.Fields(string(line)), r, w)
+		if err != nil || quit {
+			return err
+		}
+
+		// flush when all pipelined commands are answered
+		if r.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// handleMemcached writes the reply to the command, returns true if the client quits
+func handleMemcached(reader cdb.Reader, fields []string, r *bufio.Reader, w *bufio.Writer) (bool, error) {
+	if len(fields) == 0 {
+		_, err := w.WriteString("ERROR\r\n")
+		return false, err
+	}
+
+	name, args := fields[0], fields[1:]
+
+	switch name {
+	case "get", "gets":
+		if len(args) == 0 {
+			_, err := w.WriteString("ERROR\r\n")
+			return false, err
+		}
+
+		return false, writeItems(w, reader, args, name == "gets")
+	case "set", "add", "replace", "append", "prepend", "cas":
+		return false, rejectStorage(name, args, r, w)
+	case "incr", "decr", "delete", "touch", "flush_all":
+		if noreply(args) {
+			return false, nil
+		}
+
+		_, err := w.WriteString("SERVER_ERROR read only\r\n")
+		return false, err
+	case "version":
+		_, err := w.WriteString("VERSION cdb\r\n")
+		return false, err
+	case "stats":
+		_, err := fmt.Fprintf(w, "STAT curr_items %d\r\nEND\r\n", reader.Size())
+		return false, err
+	case "quit":
+		return true, nil
+	}
+
+	_, err := w.WriteString("ERROR\r\n")
+	return false, err
+}
+
+// writeItems writes values of found keys followed by END, with cas unique values if cas is true
+func writeItems(w *bufio.Writer, reader cdb.Reader, keys []string, cas bool) error {
+	for _, key := range keys {
+		if len(key) > maxKeyLen {
+			_, err := w.WriteString("CLIENT_ERROR bad command line format\r\n")
+			return err
+		}
+	}
+
+	for _, key := range keys {
+		value, err := reader.Get([]byte(key))
+		if err == cdb.ErrEntryNotFound {
+			continue
+		}
+
+		if err != nil {
+			_, err = fmt.Fprintf(w, "SERVER_ERROR %s\r\n", err)
+			return err
+		}
+
+		if cas {
+			fmt.Fprintf(w, "VALUE %s 0 %d %d\r\n", key, len(value), casUnique(value))
+		} else {
+			fmt.Fprintf(w, "VALUE %s 0 %d\r\n", key, len(value))
+		}
+
+		w.Write(value)
+		w.WriteString("\r\n")
+	}
+
+	_, err := w.WriteString("END\r\n")
+
+	return err
+}
+
+// rejectStorage skips the data block of a storage command and answers it with SERVER_ERROR.
+// The command line is "<name> <key> <flags> <exptime> <bytes> [<cas unique>] [noreply]".
+func rejectStorage(name string, args []string, r *bufio.Reader, w *bufio.Writer) error {
+	size := -1
+
+	required := 4
+	if name == "cas" {
+		required++
+	}
+
+	if len(args) >= required {
+		size, _ = strconv.Atoi(args[3])
+	}
+
+	if size < 0 || size > maxDataSize {
+		_, err := w.WriteString("CLIENT_ERROR bad command line format\r\n")
+		return err
+	}
+
+	if _, err := r.Discard(size); err != nil {
+		return err
+	}
+
+	end, err := readLine(r)
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+
+	if err != nil && err != errProtocol {
+		return err
+	}
+
+	if err == errProtocol || len(end) != 0 {
+		_, err := w.WriteString("CLIENT_ERROR bad data chunk\r\n")
+		return err
+	}
+
+	if noreply(args) {
+		return nil
+	}
+
+	_, err = w.WriteString("SERVER_ERROR read only\r\n")
+
+	return err
+}
+
+// noreply tells if the client does not wait for a reply
+func noreply(args []string) bool {
+	return len(args) > 0 && args[len(args)-1] == "noreply"
+}
+
+// casUnique returns the cas unique value of the value. The database is constant,
+// so a hash of the value is stable for all clients and servers.
+func casUnique(value []byte) uint64 {
+	hash := fnv.New64a()
+	hash.Write(value)
+
+	return hash.Sum64()
+}
@@ -0,0 +1,287 @@
+package kvserver
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/alldroll/cdb"
+)
+
+const (
+	// Max number of arguments of a RESP command, i.e. the largest MGET or EXISTS batch
+	maxArgs = 1024
+	// Max size of a RESP bulk string, the same as the max size of a memcached data block
+	maxBulkSize = 1 << 20
+)
+
+// errProtocol tells that a client does not speak the protocol
+var errProtocol = errors.New("protocol error")
+
+// respWriteCommands are Redis commands which modify data, they are answered with READONLY errors
+var respWriteCommands = map[string]bool{
+	"set": true, "setnx": true, "setex": true, "psetex": true, "mset": true, "msetnx": true, "getset": true,
+	"getdel": true, "getex": true, "append": true, "setrange": true, "incr": true, "incrby": true,
+	"incrbyfloat": true, "decr": true, "decrby": true, "del": true, "unlink": true, "expire": true,
+	"pexpire": true, "expireat": true, "pexpireat": true, "persist": true, "rename": true, "renamenx": true,
+	"move": true, "copy": true, "restore": true, "flushdb": true, "flushall": true, "hset": true, "hmset": true,
+	"hdel": true, "lpush": true, "rpush": true, "lpop": true, "rpop": true, "sadd": true, "srem": true,
+	"zadd": true, "zrem": true,
+}
+
+// serveRESP handles Redis commands until the client quits or the connection fails
+func serveRESP(reader cdb.Reader, r *bufio.Reader, w *bufio.Writer) error {
+	for {
+		args, err := readRESPCommand(r)
+		if err == errProtocol {
+			w.WriteString("-ERR Protocol error\r\n")
+			return err
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if len(args) == 0 {
+			continue
+		}
+
+		quit, err := handleRESP(reader, args, w)
+		if err != nil || quit {
+			return err
+		}
+
+		// flush when all pipelined commands are answered
+		if r.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// handleRESP writes the reply to the command, returns true if the client quits
+func handleRESP(reader cdb.Reader, args [][]byte, w *bufio.Writer) (bool, error) {
+	name := strings.ToLower(string(args[0]))
+	args = args[1:]
+
+	switch name {
+	case "get":
+		if len(args) != 1 {
+			return false, writeArity(w, name)
+		}
+
+		return false, writeValue(w, reader, args[0])
+	case "mget":
+		if len(args) == 0 {
+			return false, writeArity(w, name)
+		}
+
+		fmt.Fprintf(w, "*%d\r\n", len(args))
+
+		for _, key := range args {
+			if err := writeValue(w, reader, key); err != nil {
+				return false, err
+			}
+		}
+
+		return false, nil
+	case "exists":
+		if len(args) == 0 {
+			return false, writeArity(w, name)
+		}
+
+		count := 0
+
+		for _, key := range args {
+			found, err := reader.Has(key)
+			if err != nil {
+				return false, writeError(w, "ERR "+err.Error())
+			}
+
+			if found {
+				count++
+			}
+		}
+
+		return false, writeInteger(w, count)
+	case "strlen":
+		if len(args) != 1 {
+			return false, writeArity(w, name)
+		}
+
+		value, err := reader.Get(args[0])
+		if err != nil && err != cdb.ErrEntryNotFound {
+			return false, writeError(w, "ERR "+err.Error())
+		}
+
+		return false, writeInteger(w, len(value))
+	case "dbsize":
+		return false, writeInteger(w, reader.Size())
+	case "ping":
+		if len(args) > 0 {
+			return false, writeBulk(w, args[0])
+		}
+
+		_, err := w.WriteString("+PONG\r\n")
+		return false, err
+	case "echo":
+		if len(args) != 1 {
+			return false, writeArity(w, name)
+		}
+
+		return false, writeBulk(w, args[0])
+	case "select":
+		if len(args) != 1 {
+			return false, writeArity(w, name)
+		}
+
+		if string(args[0]) != "0" {
+			return false, writeError(w, "ERR DB index is out of range")
+		}
+
+		_, err := w.WriteString("+OK\r\n")
+		return false, err
+	case "command":
+		_, err := w.WriteString("*0\r\n")
+		return false, err
+	case "client":
+		_, err := w.WriteString("+OK\r\n")
+		return false, err
+	case "quit":
+		_, err := w.WriteString("+OK\r\n")
+		return true, err
+	}
+
+	if respWriteCommands[name] {
+		return false, writeError(w, "READONLY You can't write against a read only replica.")
+	}
+
+	return false, writeError(w, fmt.Sprintf("ERR unknown command '%s'", name))
+}
+
+// readRESPCommand reads an array of bulk strings or an inline command
+func readRESPCommand(r *bufio.Reader) ([][]byte, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) == 0 || line[0] != '*' {
+		fields := strings.Fields(string(line))
+		args := make([][]byte, len(fields))
+
+		for i, field := range fields {
+			args[i] = []byte(field)
+		}
+
+		return args, nil
+	}
+
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n > maxArgs {
+		return nil, errProtocol
+	}
+
+	args := make([][]byte, 0, max(n, 0))
+
+	for i := 0; i < n; i++ {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(line) == 0 || line[0] != '$' {
+			return nil, errProtocol
+		}
+
+		size, err := strconv.Atoi(string(line[1:]))
+		if err != nil || size < 0 || size > maxBulkSize {
+			return nil, errProtocol
+		}
+
+		// the buffer grows as data arrives, so a declared size does not allocate memory by itself
+		var buf bytes.Buffer
+		if _, err := io.CopyN(&buf, r, int64(size)+2); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+
+			return nil, err
+		}
+
+		arg := buf.Bytes()
+
+		if arg[size] != '\r' || arg[size+1] != '\n' {
+			return nil, errProtocol
+		}
+
+		args = append(args, arg[:size])
+	}
+
+	return args, nil
+}
+
+// readLine reads a line terminated by \r\n or \n, without the terminator
+func readLine(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return nil, errProtocol
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	line = line[:len(line)-1]
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		line = line[:len(line)-1]
+	}
+
+	return line, nil
+}
+
+// writeValue writes the value of the key as a bulk string, or the null bulk string if there is no such key
+func writeValue(w *bufio.Writer, reader cdb.Reader, key []byte) error {
+	value, err := reader.Get(key)
+	if err == cdb.ErrEntryNotFound {
+		_, err = w.WriteString("$-1\r\n")
+		return err
+	}
+
+	if err != nil {
+		return writeError(w, "ERR "+err.Error())
+	}
+
+	return writeBulk(w, value)
+}
+
+// writeBulk writes a bulk string
+func writeBulk(w *bufio.Writer, value []byte) error {
+	fmt.Fprintf(w, "$%d\r\n", len(value))
+	w.Write(value)
+	_, err := w.WriteString("\r\n")
+
+	return err
+}
+
+// writeInteger writes an integer reply
+func writeInteger(w *bufio.Writer, n int) error {
+	_, err := fmt.Fprintf(w, ":%d\r\n", n)
+	return err
+}
+
+// writeError writes an error reply
+func writeError(w *bufio.Writer, message string) error {
+	_, err := fmt.Fprintf(w, "-%s\r\n", message)
+	return err
+}
+
+// writeArity writes the error of a wrong number of arguments
+func writeArity(w *bufio.Writer, name string) error {
+	return writeError(w, fmt.Sprintf("ERR wrong number of arguments for '%s' command", name))
+}
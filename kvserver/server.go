@@ -0,0 +1,165 @@
+// Package kvserver answers lookups in a constant database over the Redis (RESP) and memcached text protocols,
+// so a cdb file can replace a cache instance holding static data without client changes. The server is read-only:
+// write commands are answered with errors.
+package kvserver
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/alldroll/cdb"
+)
+
+// ErrServerClosed is returned by Serve after Close
+var ErrServerClosed = errors.New("kvserver: server closed")
+
+// session handles commands of one connection until it returns
+type session func(reader cdb.Reader, r *bufio.Reader, w *bufio.Writer) error
+
+// Server serves a protocol on listeners. All methods are safe for concurrent use.
+type Server struct {
+	reader  cdb.Reader
+	session session
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// NewRESP returns a new Server which speaks the Redis protocol.
+// It supports GET, MGET, EXISTS, STRLEN, DBSIZE, PING, ECHO, SELECT 0 and QUIT,
+// write commands are answered with READONLY errors, like a read-only replica does.
+func NewRESP(reader cdb.Reader) *Server {
+	return newServer(reader, serveRESP)
+}
+
+// NewMemcached returns a new Server which speaks the memcached text protocol.
+// It supports get, gets, version, stats and quit, storage commands are answered with SERVER_ERROR.
+func NewMemcached(reader cdb.Reader) *Server {
+	return newServer(reader, serveMemcached)
+}
+
+// newServer returns a new Server of the given protocol
+func newServer(reader cdb.Reader, session session) *Server {
+	return &Server{
+		reader:    reader,
+		session:   session,
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+}
+
+// ListenAndServe listens on the TCP address and serves connections, see Serve
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(l)
+}
+
+// Serve accepts connections on the listener and serves each of them in a new goroutine.
+// It returns ErrServerClosed after Close, otherwise the error of Accept.
+func (s *Server) Serve(l net.Listener) error {
+	if !s.track(l) {
+		l.Close()
+		return ErrServerClosed
+	}
+
+	defer s.untrack(l)
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+
+			return err
+		}
+
+		if !s.track(conn) {
+			conn.Close()
+			return ErrServerClosed
+		}
+
+		go s.serve(conn)
+	}
+}
+
+// Close closes all listeners and connections and waits for connection handlers to finish
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+
+	for l := range s.listeners {
+		l.Close()
+	}
+
+	for conn := range s.conns {
+		conn.Close()
+	}
+
+	s.mu.Unlock()
+	s.wg.Wait()
+
+	return nil
+}
+
+// serve handles commands of the connection until it is closed
+func (s *Server) serve(conn net.Conn) {
+	defer s.untrack(conn)
+
+	w := bufio.NewWriter(conn)
+	s.session(s.reader, bufio.NewReader(conn), w)
+	w.Flush()
+}
+
+// track registers a listener or a connection, returns false if the server is closed
+func (s *Server) track(c interface{}) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+
+	switch c := c.(type) {
+	case net.Listener:
+		s.listeners[c] = struct{}{}
+	case net.Conn:
+		s.conns[c] = struct{}{}
+		s.wg.Add(1)
+	}
+
+	return true
+}
+
+// untrack closes and forgets a listener or a connection
+func (s *Server) untrack(c interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch c := c.(type) {
+	case net.Listener:
+		c.Close()
+		delete(s.listeners, c)
+	case net.Conn:
+		c.Close()
+		delete(s.conns, c)
+		s.wg.Done()
+	}
+}
+
+// isClosed tells if Close was called
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.closed
+}
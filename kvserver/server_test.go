@@ -0,0 +1,179 @@
+package kvserver
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alldroll/cdb"
+	"github.com/stretchr/testify/suite"
+)
+
+type ServerTestSuite struct {
+	suite.Suite
+	reader cdb.Reader
+}
+
+// client is a connection to a test server
+type client struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func (suite *ServerTestSuite) SetupTest() {
+	f, err := os.Create(filepath.Join(suite.T().TempDir(), "test.cdb"))
+	suite.Require().Nil(err)
+	suite.T().Cleanup(func() { f.Close() })
+
+	handle := cdb.New()
+
+	writer, err := handle.GetWriter(f)
+	suite.Require().Nil(err)
+
+	for _, c := range [][2]string{{"key", "value"}, {"other", "another value"}, {"bin", "\r\n\x00"}} {
+		suite.Require().Nil(writer.Put([]byte(c[0]), []byte(c[1])))
+	}
+
+	suite.Require().Nil(writer.Close())
+
+	suite.reader, err = handle.GetReader(f)
+	suite.Require().Nil(err)
+}
+
+// start serves the server on a local listener and returns a connected client
+func (suite *ServerTestSuite) start(server *Server) *client {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	suite.Require().Nil(err)
+
+	done := make(chan error, 1)
+	go func() { done <- server.Serve(l) }()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	suite.Require().Nil(err)
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	suite.T().Cleanup(func() {
+		conn.Close()
+		suite.Nil(server.Close())
+		suite.Equal(ErrServerClosed, <-done)
+	})
+
+	return &client{conn: conn, r: bufio.NewReader(conn)}
+}
+
+// roundTrip sends the request and reads the reply of the expected size
+func (suite *ServerTestSuite) roundTrip(c *client, request, expected string) {
+	_, err := io.WriteString(c.conn, request)
+	suite.Require().Nil(err)
+
+	reply := make([]byte, len(expected))
+	_, err = io.ReadFull(c.r, reply)
+	suite.Require().Nil(err)
+	suite.Equal(expected, string(reply))
+}
+
+func (suite *ServerTestSuite) TestRESPGet() {
+	c := suite.start(NewRESP(suite.reader))
+
+	suite.roundTrip(c, "*2\r\n$3\r\nGET\r\n$3\r\nkey\r\n", "$5\r\nvalue\r\n")
+	suite.roundTrip(c, "*2\r\n$3\r\nget\r\n$7\r\nmissing\r\n", "$-1\r\n")
+	suite.roundTrip(c, "*2\r\n$3\r\nGET\r\n$3\r\nbin\r\n", "$3\r\n\r\n\x00\r\n")
+	suite.roundTrip(c, "*4\r\n$4\r\nMGET\r\n$3\r\nkey\r\n$1\r\nx\r\n$5\r\nother\r\n",
+		"*3\r\n$5\r\nvalue\r\n$-1\r\n$13\r\nanother value\r\n")
+	suite.roundTrip(c, "*4\r\n$6\r\nEXISTS\r\n$3\r\nkey\r\n$1\r\nx\r\n$3\r\nkey\r\n", ":2\r\n")
+	suite.roundTrip(c, "*2\r\n$6\r\nSTRLEN\r\n$5\r\nother\r\n", ":13\r\n")
+	suite.roundTrip(c, "*1\r\n$6\r\nDBSIZE\r\n", ":3\r\n")
+}
+
+func (suite *ServerTestSuite) TestRESPInlineAndPipeline() {
+	c := suite.start(NewRESP(suite.reader))
+
+	suite.roundTrip(c, "PING\r\nget key\r\nECHO hi\r\n", "+PONG\r\n$5\r\nvalue\r\n$2\r\nhi\r\n")
+	suite.roundTrip(c, "SELECT 0\r\nSELECT 1\r\n", "+OK\r\n-ERR DB index is out of range\r\n")
+}
+
+func (suite *ServerTestSuite) TestRESPErrors() {
+	c := suite.start(NewRESP(suite.reader))
+
+	suite.roundTrip(c, "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$1\r\nx\r\n",
+		"-READONLY You can't write against a read only replica.\r\n")
+	suite.roundTrip(c, "DEL key\r\n", "-READONLY You can't write against a read only replica.\r\n")
+	suite.roundTrip(c, "GET\r\n", "-ERR wrong number of arguments for 'get' command\r\n")
+	suite.roundTrip(c, "FOO\r\n", "-ERR unknown command 'foo'\r\n")
+	suite.roundTrip(c, "QUIT\r\n", "+OK\r\n")
+
+	_, err := c.r.ReadByte()
+	suite.Equal(io.EOF, err)
+}
+
+func (suite *ServerTestSuite) TestRESPProtocolError() {
+	for _, request := range []string{
+		"*1\r\n+GET\r\n",
+		fmt.Sprintf("*%d\r\n", maxArgs+1),
+		fmt.Sprintf("*2\r\n$3\r\nGET\r\n$%d\r\n", maxBulkSize+1),
+	} {
+		c := suite.start(NewRESP(suite.reader))
+
+		suite.roundTrip(c, request, "-ERR Protocol error\r\n")
+
+		_, err := c.r.ReadByte()
+		suite.Equal(io.EOF, err)
+	}
+}
+
+func (suite *ServerTestSuite) TestRESPMaxArgs() {
+	c := suite.start(NewRESP(suite.reader))
+
+	request, expected := fmt.Sprintf("*%d\r\n$6\r\nEXISTS\r\n", maxArgs), ":0\r\n"
+	for i := 1; i < maxArgs; i++ {
+		request += "$7\r\nmissing\r\n"
+	}
+
+	suite.roundTrip(c, request, expected)
+}
+
+func (suite *ServerTestSuite) TestMemcachedGet() {
+	c := suite.start(NewMemcached(suite.reader))
+
+	suite.roundTrip(c, "get key\r\n", "VALUE key 0 5\r\nvalue\r\nEND\r\n")
+	suite.roundTrip(c, "get missing\r\n", "END\r\n")
+	suite.roundTrip(c, "get key missing bin\r\n", "VALUE key 0 5\r\nvalue\r\nVALUE bin 0 3\r\n\r\n\x00\r\nEND\r\n")
+	suite.roundTrip(c, "gets key\r\n", fmt.Sprintf("VALUE key 0 5 %d\r\nvalue\r\nEND\r\n", casUnique([]byte("value"))))
+	suite.roundTrip(c, "stats\r\nversion\r\n", "STAT curr_items 3\r\nEND\r\nVERSION cdb\r\n")
+}
+
+func (suite *ServerTestSuite) TestMemcachedWrites() {
+	c := suite.start(NewMemcached(suite.reader))
+
+	suite.roundTrip(c, "set key 0 0 3\r\nabc\r\n", "SERVER_ERROR read only\r\n")
+	suite.roundTrip(c, "cas key 0 0 2 1\r\nab\r\n", "SERVER_ERROR read only\r\n")
+	// noreply commands are not answered, so the next reply belongs to get
+	suite.roundTrip(c, "add new 0 0 1 noreply\r\nx\r\ndelete key noreply\r\nget key\r\n",
+		"VALUE key 0 5\r\nvalue\r\nEND\r\n")
+	suite.roundTrip(c, "incr key 1\r\n", "SERVER_ERROR read only\r\n")
+	suite.roundTrip(c, "set key 0 0 1\r\nabc\r\n", "CLIENT_ERROR bad data chunk\r\n")
+	suite.roundTrip(c, "set key 0\r\n", "CLIENT_ERROR bad command line format\r\n")
+	suite.roundTrip(c, "foo\r\nget\r\n", "ERROR\r\nERROR\r\n")
+	suite.roundTrip(c, "quit\r\n", "")
+
+	_, err := c.r.ReadByte()
+	suite.Equal(io.EOF, err)
+}
+
+func (suite *ServerTestSuite) TestServeAfterClose() {
+	server := NewRESP(suite.reader)
+	suite.Nil(server.Close())
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	suite.Require().Nil(err)
+	suite.Equal(ErrServerClosed, server.Serve(l))
+}
+
+func TestServerTestSuite(t *testing.T) {
+	suite.Run(t, new(ServerTestSuite))
+}
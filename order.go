@@ -0,0 +1,30 @@
+package cdb
+
+import "bytes"
+
+// Comparator defines the order of keys, it returns a negative number if a < b, zero if a == b
+// and a positive number if a > b, like bytes.Compare.
+type Comparator func(a, b []byte) int
+
+// byKeySeq returns recordLess which orders records by key using cmp,
+// records of equal keys are kept in the order of Put calls
+func byKeySeq(cmp Comparator) recordLess {
+	return func(a, b *sortRecord) bool {
+		if c := cmp(a.key, b.key); c != 0 {
+			return c < 0
+		}
+
+		return a.seq < b.seq
+	}
+}
+
+// byKeyThenValue returns recordLess which orders records by key using cmp, then by value
+func byKeyThenValue(cmp Comparator) recordLess {
+	return func(a, b *sortRecord) bool {
+		if c := cmp(a.key, b.key); c != 0 {
+			return c < 0
+		}
+
+		return bytes.Compare(a.value, b.value) < 0
+	}
+}
@@ -0,0 +1,85 @@
+package cdb
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+)
+
+func (suite *CDBTestSuite) sortedKeys() [][]byte {
+	reader := suite.getCDBReader()
+	iterator, err := reader.Iterator()
+	suite.Require().Nil(err)
+
+	var keys [][]byte
+
+	for ok := true; ok; {
+		key, err := iterator.Key()
+		suite.Require().Nil(err)
+		keys = append(keys, key)
+
+		ok, err = iterator.Next()
+		suite.Require().Nil(err)
+	}
+
+	return keys
+}
+
+func (suite *CDBTestSuite) TestSortedLayout() {
+	suite.testRecords = nil
+
+	for i := 500; i > 0; i-- {
+		stri := strconv.Itoa(i)
+		suite.testRecords = append(suite.testRecords, testCDBRecord{
+			key: []byte("key" + stri),
+			val: []byte("val" + stri),
+		})
+	}
+
+	suite.cdbHandle.SetOrder(bytes.Compare)
+	writer := suite.getCDBWriter()
+	writer.(*parallelWriter).sorter.runSize = 1000
+
+	for _, rec := range suite.testRecords {
+		suite.Require().Nil(writer.Put(rec.key, rec.val))
+	}
+
+	suite.Require().Nil(writer.Close())
+
+	keys := suite.sortedKeys()
+	suite.Len(keys, len(suite.testRecords))
+	suite.True(sort.SliceIsSorted(keys, func(i, j int) bool {
+		return bytes.Compare(keys[i], keys[j]) < 0
+	}))
+
+	suite.TestShouldReturnAllValues()
+}
+
+func (suite *CDBTestSuite) TestSortedLayoutWithComparator() {
+	suite.cdbHandle.SetOrder(func(a, b []byte) int {
+		return bytes.Compare(b, a)
+	})
+	suite.fillTestCDB()
+
+	keys := suite.sortedKeys()
+	suite.Len(keys, len(suite.testRecords))
+
+	for i := range keys {
+		suite.Equal(suite.testRecords[len(keys)-1-i].key, keys[i])
+	}
+}
+
+func (suite *CDBTestSuite) TestSortedLayoutKeepsOrderOfDuplicates() {
+	suite.cdbHandle.SetOrder(bytes.Compare)
+	writer := suite.getCDBWriter()
+
+	suite.Require().Nil(writer.Put([]byte("b"), []byte("2")))
+	suite.Require().Nil(writer.Put([]byte("a"), []byte("1")))
+	suite.Require().Nil(writer.Put([]byte("b"), []byte("1")))
+	suite.Require().Nil(writer.Close())
+
+	value, err := suite.getCDBReader().Get([]byte("b"))
+	suite.Nil(err)
+	suite.Equal([]byte("2"), value, "the first put record should be returned")
+	suite.Equal([][]byte{[]byte("a"), []byte("b"), []byte("b")}, suite.sortedKeys())
+}
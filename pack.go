@@ -0,0 +1,181 @@
+package cdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// MetadataPrefix is the prefix of keys of file metadata stored by Pack. It is not a valid fs path,
+// so metadata is not visible through FS as files.
+const MetadataPrefix = "/.meta/"
+
+// FileMetadata describes a packed file, see PackOptions.Metadata
+type FileMetadata struct {
+	// Mode is the permission bits of the file
+	Mode fs.FileMode `json:"mode"`
+	// ModTime is the modification time of the file, zero for reproducible builds
+	ModTime time.Time `json:"mtime,omitempty"`
+	// ContentType is the MIME type of the file, guessed by extension or content
+	ContentType string `json:"type,omitempty"`
+}
+
+// PackOptions tells which files Pack stores and how
+type PackOptions struct {
+	// Include holds glob patterns (see path.Match) of files to pack, all files are packed if it is empty.
+	// A pattern without a slash is matched against the base name, otherwise against the whole path.
+	Include []string
+	// Exclude holds glob patterns of files and directories to skip, it takes precedence over Include
+	Exclude []string
+	// Metadata tells to store FileMetadata of each file under MetadataPrefix + path
+	Metadata bool
+	// Reproducible tells to drop modification times, so the database depends only on paths,
+	// contents and modes of files
+	Reproducible bool
+}
+
+// PackDir stores regular files of the given directory into the writer, see Pack.
+func PackDir(writer Writer, dir string, options PackOptions) error {
+	return Pack(writer, os.DirFS(dir), options)
+}
+
+// Pack stores regular files of the filesystem into the writer under their slash-separated paths,
+// so the database can be read back by FS. Files are visited in lexical order and streamed by Writer.PutReader,
+// so the output does not depend on the order of directory entries, and large files are not loaded into memory.
+// The writer is not closed.
+func Pack(writer Writer, fsys fs.FS, options PackOptions) error {
+	for _, patterns := range [][]string{options.Include, options.Exclude} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return err
+			}
+		}
+	}
+
+	return fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if name == "." {
+			return nil
+		}
+
+		if matchAny(options.Exclude, name) {
+			if entry.IsDir() {
+				return fs.SkipDir
+			}
+
+			return nil
+		}
+
+		if !entry.Type().IsRegular() || (len(options.Include) > 0 && !matchAny(options.Include, name)) {
+			return nil
+		}
+
+		return packFile(writer, fsys, name, options)
+	})
+}
+
+// packFile stores the file and its metadata into the writer
+func packFile(writer Writer, fsys fs.FS, name string, options PackOptions) error {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	if uint64(info.Size()) > maxUint {
+		return ErrOutOfMemory
+	}
+
+	var (
+		content io.Reader = f
+		head    []byte
+	)
+
+	if options.Metadata {
+		// keep the beginning of the file for content type detection
+		head = make([]byte, 512)
+
+		n, err := io.ReadFull(f, head)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+
+		head = head[:n]
+		content = io.MultiReader(bytes.NewReader(head), f)
+	}
+
+	if err := writer.PutReader([]byte(name), content, uint32(info.Size())); err != nil {
+		return err
+	}
+
+	if !options.Metadata {
+		return nil
+	}
+
+	metadata := FileMetadata{
+		Mode:        info.Mode().Perm(),
+		ContentType: mime.TypeByExtension(path.Ext(name)),
+	}
+
+	if metadata.ContentType == "" {
+		metadata.ContentType = http.DetectContentType(head)
+	}
+
+	if !options.Reproducible {
+		metadata.ModTime = info.ModTime().UTC()
+	}
+
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+
+	return writer.Put([]byte(MetadataPrefix+name), data)
+}
+
+// ReadMetadata returns metadata of the given file stored by Pack, ErrEntryNotFound if there is no metadata
+func ReadMetadata(reader Reader, name string) (FileMetadata, error) {
+	var metadata FileMetadata
+
+	data, err := reader.Get([]byte(MetadataPrefix + name))
+	if err != nil {
+		return metadata, err
+	}
+
+	err = json.Unmarshal(data, &metadata)
+
+	return metadata, err
+}
+
+// matchAny tells if the path matches any of the patterns.
+// A pattern without a slash is matched against the base name of the path.
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		subject := name
+		if !strings.Contains(pattern, "/") {
+			subject = path.Base(name)
+		}
+
+		if ok, _ := path.Match(pattern, subject); ok {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,117 @@
+package cdb
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+func (suite *CDBTestSuite) makeTestTree() string {
+	dir := suite.T().TempDir()
+	files := map[string]string{
+		"index.html":      "<html></html>",
+		"css/site.css":    "body {}",
+		"data/blob":       string(bytes.Repeat([]byte{0, 1, 2}, 100000)),
+		"tmp/cache.txt":   "skip me",
+		"notes.txt~":      "backup",
+		"docs/readme.txt": "hello",
+	}
+
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		suite.Require().Nil(os.MkdirAll(filepath.Dir(path), 0755))
+		suite.Require().Nil(os.WriteFile(path, []byte(content), 0640))
+		suite.Require().Nil(os.Chtimes(path, time.Now(), time.Unix(1000, 0)))
+	}
+
+	return dir
+}
+
+func (suite *CDBTestSuite) packTestTree(dir string, options PackOptions) {
+	_, err := suite.cdbFile.Seek(0, io.SeekStart)
+	suite.Require().Nil(err)
+
+	writer := suite.getCDBWriter()
+	suite.Require().Nil(PackDir(writer, dir, options))
+	suite.Require().Nil(writer.Close())
+}
+
+func (suite *CDBTestSuite) TestPackDir() {
+	dir := suite.makeTestTree()
+	suite.packTestTree(dir, PackOptions{
+		Exclude:  []string{"tmp", "*~"},
+		Metadata: true,
+	})
+
+	reader := suite.getCDBReader()
+	fsys := FS(reader)
+
+	var names []string
+
+	err := fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() {
+			names = append(names, name)
+		}
+
+		return err
+	})
+
+	suite.Nil(err)
+	suite.Equal([]string{"css/site.css", "data/blob", "docs/readme.txt", "index.html"}, names)
+
+	blob, err := fs.ReadFile(fsys, "data/blob")
+	suite.Nil(err)
+	suite.Equal(bytes.Repeat([]byte{0, 1, 2}, 100000), blob)
+
+	metadata, err := ReadMetadata(reader, "css/site.css")
+	suite.Require().Nil(err)
+	suite.Equal(fs.FileMode(0640), metadata.Mode)
+	suite.True(metadata.ModTime.Equal(time.Unix(1000, 0)))
+	suite.Contains(metadata.ContentType, "text/css")
+
+	metadata, err = ReadMetadata(reader, "data/blob")
+	suite.Require().Nil(err)
+	suite.Equal("application/octet-stream", metadata.ContentType)
+
+	info, err := fs.Stat(fsys, "index.html")
+	suite.Require().Nil(err)
+	suite.Equal(fs.FileMode(0640), info.Mode())
+	suite.True(info.ModTime().Equal(time.Unix(1000, 0)))
+}
+
+func (suite *CDBTestSuite) TestPackDirInclude() {
+	dir := suite.makeTestTree()
+	suite.packTestTree(dir, PackOptions{Include: []string{"*.txt", "css/*"}, Exclude: []string{"tmp"}})
+
+	var keys []string
+
+	for key := range suite.getCDBReader().Keys() {
+		keys = append(keys, string(key))
+	}
+
+	suite.Equal([]string{"css/site.css", "docs/readme.txt"}, keys)
+}
+
+func (suite *CDBTestSuite) TestPackDirIsReproducible() {
+	options := PackOptions{Metadata: true, Reproducible: true}
+	var builds [][]byte
+
+	for i := 0; i < 2; i++ {
+		suite.packTestTree(suite.makeTestTree(), options)
+
+		data, err := os.ReadFile(suite.cdbFile.Name())
+		suite.Require().Nil(err)
+		builds = append(builds, data)
+	}
+
+	suite.Equal(builds[0], builds[1])
+}
+
+func (suite *CDBTestSuite) TestPackDirRejectsBadPatterns() {
+	writer := suite.getCDBWriter()
+	suite.Equal(path.ErrBadPattern, PackDir(writer, suite.T().TempDir(), PackOptions{Include: []string{"["}}))
+}
@@ -0,0 +1,206 @@
+package cdb
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// parallelWriter implements Writer interface. Put is safe for concurrent use: keys are hashed
+// by calling goroutines, records are sorted in background. On Close records are written ordered
+// by key (and by value for equal keys), so the output does not depend on the order of Put calls,
+// and hash tables are built by several goroutines. With a single goroutine and records of equal keys
+// ordered by Put calls it is also used as the writer of sorted databases, see CDB.SetOrder.
+type parallelWriter struct {
+	writer *writerImpl
+	mu     sync.Mutex
+	sorter *recordSorter
+	seq    uint64
+	err    error
+	// stats describes buffered records
+	stats    WriterStats
+	progress progress
+}
+
+// newParallelWriter returns a new instance of parallelWriter which uses the given number of goroutines
+// and writes records in the given order
+func newParallelWriter(writer *writerImpl, workers int, tempDir string, less recordLess) *parallelWriter {
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+
+	writer.workers = workers
+
+	w := &parallelWriter{
+		writer:   writer,
+		sorter:   newRecordSorter(less, defaultRunSize, workers, tempDir),
+		stats:    writer.Stats(),
+		progress: writer.progress,
+	}
+
+	// the progress is reported on Put, writing of sorted records on Close is not reported
+	writer.progress = progress{}
+
+	return w
+}
+
+// Put saves a new associated pair <key, value> into databases. Returns an error on failure.
+func (w *parallelWriter) Put(key, value []byte) error {
+	if uint64(len(key)) > maxUint || uint64(len(value)) > maxUint {
+		return ErrOutOfMemory
+	}
+
+	hashFunc := w.writer.hasher()
+	hashFunc.Write(key)
+
+	data := make([]byte, len(key)+len(value))
+	copy(data, key)
+	copy(data[len(key):], value)
+
+	rec := sortRecord{
+		hash:  hashFunc.Sum32(),
+		key:   data[:len(key):len(key)],
+		value: data[len(key):],
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return w.err
+	}
+
+	size := int64(8 + len(key) + len(value))
+
+	if w.estimatedSize()+size+2*slotSize >= maxUint {
+		return ErrOutOfMemory
+	}
+
+	rec.seq = w.seq
+	w.seq++
+
+	if w.err = w.sorter.add(rec); w.err != nil {
+		return w.err
+	}
+
+	w.stats.Records++
+	w.stats.Bytes += size
+	w.progress.report(w.currentStats)
+
+	return nil
+}
+
+// Stats returns the progress of building the database. Records are written to the file on Close,
+// so until then Offset is the position the next record would be written at.
+func (w *parallelWriter) Stats() WriterStats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.currentStats()
+}
+
+// currentStats is like Stats, but must be called under the lock
+func (w *parallelWriter) currentStats() WriterStats {
+	stats := w.stats
+	stats.Offset = tablesRefsSize + stats.Bytes
+
+	return stats
+}
+
+// EstimatedSize returns the size of the database if it was closed now: records and hash tables.
+// Optional sections written after the hash tables (filter, fingerprints) are not counted.
+func (w *parallelWriter) EstimatedSize() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.estimatedSize()
+}
+
+// estimatedSize is like EstimatedSize, but must be called under the lock
+func (w *parallelWriter) estimatedSize() int64 {
+	return tablesRefsSize + w.stats.Bytes + 2*slotSize*int64(w.stats.Records)
+}
+
+// PutReader reads exactly size bytes of the value into memory and saves a new associated pair <key, value>
+// into databases. It does not stream the value: records are held by the sorter (and spilled to its temporary
+// files over the run size) until Close, so every value is buffered as a whole. If the reader has less bytes
+// than declared, the writer fails with ErrValueSize.
+func (w *parallelWriter) PutReader(key []byte, value io.Reader, size uint32) error {
+	buf, err := readValue(value, size)
+
+	if err != nil {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+
+		if w.err == nil {
+			w.err = err
+		}
+
+		return w.err
+	}
+
+	return w.Put(key, buf)
+}
+
+// Close commits database, makes it possible for reading.
+func (w *parallelWriter) Close() error {
+	_, err := w.CloseWithSummary()
+	return err
+}
+
+// CloseWithSummary is like Close, but also returns the summary of the committed database.
+func (w *parallelWriter) CloseWithSummary() (BuildSummary, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		w.sorter.close()
+		w.writer.release()
+
+		return BuildSummary{}, w.err
+	}
+
+	w.err = ErrWriterClosed
+
+	err := w.sorter.merge(func(rec *sortRecord) error {
+		// duplicates are found only now, so Close fails and names the key
+		if err := w.writer.putHashed(rec.key, rec.value, rec.hash); err == ErrDuplicateKey {
+			return fmt.Errorf("%w: %q", ErrDuplicateKey, rec.key)
+		} else if err != nil {
+			return err
+		}
+
+		return nil
+	})
+
+	if cerr := w.sorter.close(); err == nil {
+		err = cerr
+	}
+
+	var summary BuildSummary
+
+	if err == nil {
+		summary, err = w.writer.CloseWithSummary()
+	} else {
+		w.writer.release()
+	}
+
+	if err != nil {
+		w.err = err
+	}
+
+	return summary, err
+}
+
+// setCodecs records names of codecs of keys and values
+func (w *parallelWriter) setCodecs(key, value string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.writer.setCodecs(key, value)
+}
+
+// byKeyValue orders records by key, then by value
+var byKeyValue = byKeyThenValue(bytes.Compare)
@@ -0,0 +1,160 @@
+package cdb
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func (suite *CDBTestSuite) fillTestCDBInParallel(runSize int) {
+	writer, err := suite.cdbHandle.GetParallelWriter(suite.cdbFile, 4)
+	suite.Require().Nil(err)
+
+	if runSize > 0 {
+		writer.(*parallelWriter).sorter.runSize = runSize
+	}
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			for j := i; j < len(suite.testRecords); j += 4 {
+				err := writer.Put(suite.testRecords[j].key, suite.testRecords[j].val)
+				suite.Nilf(err, "Cant put new value to cdb: %#v", err)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	suite.Require().Nil(writer.Close())
+}
+
+func (suite *CDBTestSuite) TestParallelWriter() {
+	for i := 0; i < 1000; i++ {
+		stri := strconv.Itoa(i)
+		suite.testRecords = append(suite.testRecords, testCDBRecord{
+			key: []byte("item" + stri),
+			val: []byte("value" + stri),
+		})
+	}
+
+	suite.fillTestCDBInParallel(0)
+	first, err := ioutil.ReadFile(suite.cdbFile.Name())
+	suite.Require().Nil(err)
+
+	reader := suite.getCDBReader()
+	suite.Equal(len(suite.testRecords), reader.Size())
+
+	for _, rec := range suite.testRecords {
+		value, err := reader.Get(rec.key)
+		suite.Nil(err)
+		suite.Equal(rec.val, value)
+	}
+
+	iterator := suite.mustGetCDBIterator()
+	prev, err := iterator.Key()
+	suite.Nil(err)
+
+	for iterator.HasNext() {
+		_, err = iterator.Next()
+		suite.Nil(err)
+
+		key, err := iterator.Key()
+		suite.Nil(err)
+		suite.True(bytes.Compare(prev, key) < 0, "records must be ordered by key")
+		prev = key
+	}
+
+	suite.resetCDBFile()
+	suite.fillTestCDBInParallel(256)
+	second, err := ioutil.ReadFile(suite.cdbFile.Name())
+	suite.Require().Nil(err)
+
+	suite.True(bytes.Equal(first, second), "the output must not depend on the order of Put calls")
+}
+
+func (suite *CDBTestSuite) TestParallelWriterOnEmptyDataSet() {
+	suite.testRecords = nil
+	suite.fillTestCDBInParallel(0)
+
+	_, err := suite.getCDBIterator()
+	suite.Equal(ErrEmptyCDB, err)
+}
+
+func TestRecordSorterSpills(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cdb_sorter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sorter := newRecordSorter(byKeyValue, 100, 2, dir)
+	n := 1000
+
+	for i := n - 1; i >= 0; i-- {
+		key := []byte(strconv.Itoa(i))
+		if err := sorter.add(sortRecord{key: key, value: key}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var prev []byte
+	count := 0
+
+	err = sorter.merge(func(rec *sortRecord) error {
+		if prev != nil && bytes.Compare(prev, rec.key) >= 0 {
+			t.Errorf("records are not sorted: %s, %s", prev, rec.key)
+		}
+
+		prev = append(prev[:0], rec.key...)
+		count++
+
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count != n {
+		t.Errorf("expected %d records, got %d", n, count)
+	}
+
+	if len(sorter.runs) == 0 {
+		t.Errorf("runs should be spilled to disk")
+	}
+
+	if err := sorter.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("temporary files should be removed")
+	}
+}
+
+func BenchmarkParallelWriterPut(b *testing.B) {
+	f, _ := os.Create("test.cdb")
+	defer f.Close()
+	defer os.Remove("test.cdb")
+
+	handle := New()
+	writer, _ := handle.GetParallelWriter(f, 0)
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		j := 0
+		for pb.Next() {
+			key := []byte(strconv.Itoa(j))
+			writer.Put(key, key)
+			j++
+		}
+	})
+
+	writer.Close()
+}
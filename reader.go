@@ -2,9 +2,12 @@ package cdb
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"errors"
+	"hash/crc32"
 	"io"
+	"sync"
 )
 
 // EntryDoesNotExists could be returned for Get method is cdb has no such key
@@ -24,6 +27,23 @@ type readerImpl struct {
 	hasher Hasher
 	endPos uint32
 	size   int
+	values *ValueCache
+	owner  uint64
+	// headerSum is the checksum of the header, it binds the trailer to the database
+	headerSum uint32
+	// trailer is read on first use by loadTrailer, so opening a database takes a single read
+	trailerOnce sync.Once
+	trailerErr  error
+	// sections of the trailer
+	sections map[uint32]section
+	filter   *bloomFilter
+	// keyCodec, valueCodec are names of codecs recorded by TypedWriter
+	keyCodec, valueCodec string
+	// fingerprints holds positions of slot fingerprints of each hash table, nil if there are no fingerprints
+	fingerprints []int64
+	// seqErr is the first error which stopped a sequence, see Err
+	seqMu  sync.Mutex
+	seqErr error
 }
 
 // newReader returns a new readerImpl object on success, otherwise returns nil and an error
@@ -55,6 +75,8 @@ func (r *readerImpl) initialize() error {
 		r.size += int(r.refs[i].length >> 1)
 	}
 
+	r.headerSum = crc32.Checksum(buf, castagnoli)
+
 	for _, ref := range &r.refs {
 		if ref.position != 0 {
 			r.endPos = ref.position
@@ -65,6 +87,88 @@ func (r *readerImpl) initialize() error {
 	return nil
 }
 
+// loadTrailer reads optional sections stored after the hash tables once, returns the error of the first call
+func (r *readerImpl) loadTrailer() error {
+	r.trailerOnce.Do(func() {
+		r.trailerErr = r.initializeSections()
+	})
+
+	return r.trailerErr
+}
+
+// readTrailer reads the table of contents of the trailer
+func (r *readerImpl) readTrailer() (trailer, error) {
+	var tablesSize int64
+
+	for _, ref := range &r.refs {
+		tablesSize += int64(ref.length) * slotSize
+	}
+
+	return readTrailer(r.reader, r.headerSum, r.tablesEnd(), tablesSize)
+}
+
+// initializeSections reads optional sections stored after the hash tables
+func (r *readerImpl) initializeSections() error {
+	t, err := r.readTrailer()
+	if err != nil {
+		return err
+	}
+
+	sections := t.sections
+	r.sections = sections
+
+	if s, ok := sections[filterSection]; ok {
+		data, err := s.read(r.reader)
+		if err != nil {
+			return err
+		}
+
+		if r.filter, err = decodeBloomFilter(data); err != nil {
+			return err
+		}
+	}
+
+	if s, ok := sections[codecSection]; ok {
+		data, err := s.read(r.reader)
+		if err != nil {
+			return err
+		}
+
+		if r.keyCodec, r.valueCodec, err = decodeCodecs(data); err != nil {
+			return err
+		}
+	}
+
+	if s, ok := sections[fingerprintSection]; ok {
+		r.fingerprints = make([]int64, tableNum)
+		position := s.position
+
+		for i, ref := range &r.refs {
+			r.fingerprints[i] = position
+			position += int64(ref.length) * 4
+		}
+
+		if position != s.position+int64(s.size) {
+			return ErrInvalidTrailer
+		}
+	}
+
+	return nil
+}
+
+// tablesEnd returns the position of the end of hash tables, where the trailer starts
+func (r *readerImpl) tablesEnd() int64 {
+	end := int64(tablesRefsSize)
+
+	for _, ref := range &r.refs {
+		if tableEnd := int64(ref.position) + int64(ref.length)*slotSize; ref.length != 0 && tableEnd > end {
+			end = tableEnd
+		}
+	}
+
+	return end
+}
+
 // IsEmpty returns true if cdb has no records
 func (r *readerImpl) IsEmpty() bool {
 	return r.endPos == 0
@@ -72,12 +176,31 @@ func (r *readerImpl) IsEmpty() bool {
 
 // Get returns the first value associated with the given key
 func (r *readerImpl) Get(key []byte) ([]byte, error) {
-	valueSection, err := r.findEntry(key)
+	return r.GetContext(context.Background(), key)
+}
+
+// GetContext is like Get, but aborts reading as soon as ctx is done.
+func (r *readerImpl) GetContext(ctx context.Context, key []byte) ([]byte, error) {
+	if r.values != nil {
+		if value, found, ok := r.values.get(r.owner, key); ok {
+			if !found {
+				return nil, ErrEntryNotFound
+			}
+
+			return value, nil
+		}
+	}
+
+	valueSection, err := r.findEntry(r.bind(ctx), key)
 
 	if err != nil {
 		return nil, err
 	}
 	if valueSection == nil {
+		if r.values != nil {
+			r.values.put(r.owner, key, nil, false)
+		}
+
 		return nil, ErrEntryNotFound
 	}
 
@@ -87,19 +210,43 @@ func (r *readerImpl) Get(key []byte) ([]byte, error) {
 		return nil, err
 	}
 
+	if r.values != nil {
+		r.values.put(r.owner, key, value, true)
+	}
+
 	return value, nil
 }
 
 // Has returns true if the given key exists, otherwise returns false.
 func (r *readerImpl) Has(key []byte) (bool, error) {
-	valueSection, err := r.findEntry(key)
+	return r.HasContext(context.Background(), key)
+}
+
+// HasContext is like Has, but aborts reading as soon as ctx is done.
+func (r *readerImpl) HasContext(ctx context.Context, key []byte) (bool, error) {
+	if r.values != nil {
+		if _, found, ok := r.values.get(r.owner, key); ok {
+			return found, nil
+		}
+	}
+
+	valueSection, err := r.findEntry(r.bind(ctx), key)
+
+	if err == nil && valueSection == nil && r.values != nil {
+		r.values.put(r.owner, key, nil, false)
+	}
 
 	return valueSection != nil, err
 }
 
 // Iterator returns new Iterator object that points on first record
 func (r *readerImpl) Iterator() (Iterator, error) {
-	iterator, err := r.newIterator(tablesRefsSize, nil, nil)
+	return r.IteratorContext(context.Background())
+}
+
+// IteratorContext is like Iterator, but the returned Iterator passes ctx to every read it issues.
+func (r *readerImpl) IteratorContext(ctx context.Context) (Iterator, error) {
+	iterator, err := r.newIterator(r.bind(ctx), tablesRefsSize, nil, nil)
 
 	if err != nil {
 		return nil, err
@@ -114,13 +261,15 @@ func (r *readerImpl) Iterator() (Iterator, error) {
 
 // IteratorAt returns a new Iterator object that points on the first record associated with the given key.
 func (r *readerImpl) IteratorAt(key []byte) (Iterator, error) {
-	valueSection, err := r.findEntry(key)
+	reader := r.bind(context.Background())
+	valueSection, err := r.findEntry(reader, key)
 
 	if err != nil || valueSection == nil {
 		return nil, err
 	}
 
 	return r.newIterator(
+		reader,
 		valueSection.position+valueSection.size,
 		&sectionReaderFactory{
 			reader: bytes.NewReader(key),
@@ -130,24 +279,75 @@ func (r *readerImpl) IteratorAt(key []byte) (Iterator, error) {
 	)
 }
 
+// Codecs returns names of codecs of keys and values recorded by TypedWriter, empty if unknown
+func (r *readerImpl) Codecs() (key, value string) {
+	if r.loadTrailer() != nil {
+		return "", ""
+	}
+
+	return r.keyCodec, r.valueCodec
+}
+
 // Size returns the size of the dataset
 func (r *readerImpl) Size() int {
 	return r.size
 }
 
+// bind returns io.ReaderAt that passes ctx to each read of r.reader
+func (r *readerImpl) bind(ctx context.Context) io.ReaderAt {
+	if _, ok := r.reader.(ReaderAtContext); !ok && ctx.Done() == nil {
+		return r.reader
+	}
+
+	return &contextReaderAt{ctx: ctx, reader: r.reader}
+}
+
 // findEntry finds an entry for the given key
 //
+// If the database has a filter of keys, it is consulted first.
+// If the database has fingerprints, a fingerprint of a slot is compared before the record is read.
 // A record is located as follows:
 // * Compute the hash value of the key in the record.
 // * The hash value modulo 256 (tableNum) is the number of a hash table.
 // * The hash value divided by 256, modulo the length of that table, is a slot number.
 // * Probe that slot, the next higher slot, and so on, until you find the record or run into an empty slot.
-func (r *readerImpl) findEntry(key []byte) (*sectionReaderFactory, error) {
+func (r *readerImpl) findEntry(reader io.ReaderAt, key []byte) (*sectionReaderFactory, error) {
+	var valueSection *sectionReaderFactory
+
+	err := r.findEntries(reader, key, func(entry *sectionReaderFactory) bool {
+		valueSection = entry
+		return false
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return valueSection, nil
+}
+
+// findEntries calls fn for each value associated with the given key in the order of Put calls,
+// until fn returns false. See findEntry for details.
+func (r *readerImpl) findEntries(reader io.ReaderAt, key []byte, fn func(entry *sectionReaderFactory) bool) error {
+	if err := r.loadTrailer(); err != nil {
+		return err
+	}
+
+	var kh uint64
+
+	if r.filter != nil || r.fingerprints != nil {
+		kh = fnv64a(key)
+	}
+
+	if r.filter != nil && !r.filter.mayContain(kh) {
+		return nil
+	}
+
 	h := r.calcHash(key)
 	ref := &r.refs[h%tableNum]
 
 	if ref.length == 0 {
-		return nil, nil
+		return nil
 	}
 
 	var (
@@ -155,33 +355,44 @@ func (r *readerImpl) findEntry(key []byte) (*sectionReaderFactory, error) {
 		j            uint32
 		valueSection *sectionReaderFactory
 		err          error
+		matched      bool
 	)
 
 	k := (h >> 8) % ref.length
 
 	for j = 0; j < ref.length; j++ {
-		r.readPair(ref.position+k*slotSize, &entry.hash, &entry.position)
+		if err = r.readPair(reader, ref.position+k*slotSize, &entry.hash, &entry.position); err != nil {
+			return err
+		}
 
 		if entry.position == 0 {
-			return nil, nil
+			return nil
 		}
 
-		if entry.hash == h {
-			valueSection, err = r.checkEntry(entry, key)
+		matched = entry.hash == h
+
+		if matched && r.fingerprints != nil {
+			if matched, err = r.checkFingerprint(reader, h%tableNum, k, fingerprint(kh)); err != nil {
+				return err
+			}
+		}
+
+		if matched {
+			valueSection, err = r.checkEntry(reader, entry, key)
 
 			if err != nil {
-				return nil, err
+				return err
 			}
 
-			if valueSection != nil {
-				break
+			if valueSection != nil && !fn(valueSection) {
+				return nil
 			}
 		}
 
 		k = (k + 1) % ref.length
 	}
 
-	return valueSection, nil
+	return nil
 }
 
 // calcHash returns hash value of given key
@@ -192,14 +403,25 @@ func (r *readerImpl) calcHash(key []byte) uint32 {
 	return hashFunc.Sum32()
 }
 
+// checkFingerprint returns true if the slot k of the given table has the given fingerprint
+func (r *readerImpl) checkFingerprint(reader io.ReaderAt, table, k, fp uint32) (bool, error) {
+	buf := make([]byte, 4)
+
+	if _, err := reader.ReadAt(buf, r.fingerprints[table]+int64(k)*4); err != nil {
+		return false, err
+	}
+
+	return binary.LittleEndian.Uint32(buf) == fp, nil
+}
+
 // checkEntry returns io.SectionReader if given slot belongs to given key, otherwise nil
-func (r *readerImpl) checkEntry(entry slot, key []byte) (*sectionReaderFactory, error) {
+func (r *readerImpl) checkEntry(reader io.ReaderAt, entry slot, key []byte) (*sectionReaderFactory, error) {
 	var (
 		keySize, valSize uint32
 		givenKeySize     = uint32(len(key))
 	)
 
-	if err := r.readPair(entry.position, &keySize, &valSize); err != nil {
+	if err := r.readPair(reader, entry.position, &keySize, &valSize); err != nil {
 		return nil, err
 	}
 
@@ -209,7 +431,7 @@ func (r *readerImpl) checkEntry(entry slot, key []byte) (*sectionReaderFactory,
 
 	data := make([]byte, keySize)
 
-	if _, err := r.reader.ReadAt(data, int64(entry.position+8)); err != nil {
+	if _, err := reader.ReadAt(data, int64(entry.position+8)); err != nil {
 		return nil, err
 	}
 
@@ -218,17 +440,17 @@ func (r *readerImpl) checkEntry(entry slot, key []byte) (*sectionReaderFactory,
 	}
 
 	return &sectionReaderFactory{
-		reader:   r.reader,
+		reader:   reader,
 		position: entry.position + 8 + keySize,
 		size:     valSize,
 	}, nil
 }
 
-// readPair reads from r.reader uint_32 pair if possible. Returns an error on failure
-func (r *readerImpl) readPair(pos uint32, a, b *uint32) error {
+// readPair reads from the given reader uint_32 pair if possible. Returns an error on failure
+func (r *readerImpl) readPair(reader io.ReaderAt, pos uint32, a, b *uint32) error {
 	pair := make([]byte, 8, 8)
 
-	_, err := r.reader.ReadAt(pair, int64(pos))
+	_, err := reader.ReadAt(pair, int64(pos))
 	if err != nil {
 		return err
 	}
@@ -239,7 +461,7 @@ func (r *readerImpl) readPair(pos uint32, a, b *uint32) error {
 }
 
 // newIterator returns new instance of Iterator object
-func (r *readerImpl) newIterator(position uint32, keySectionFactory, valueSectionFactory *sectionReaderFactory) (Iterator, error) {
+func (r *readerImpl) newIterator(reader io.ReaderAt, position uint32, keySectionFactory, valueSectionFactory *sectionReaderFactory) (Iterator, error) {
 
 	if r.IsEmpty() {
 		return nil, ErrEmptyCDB
@@ -247,16 +469,17 @@ func (r *readerImpl) newIterator(position uint32, keySectionFactory, valueSectio
 
 	if keySectionFactory == nil {
 		keySectionFactory = &sectionReaderFactory{
-			reader: r.reader,
+			reader: reader,
 		}
 	}
 	if valueSectionFactory == nil {
 		valueSectionFactory = &sectionReaderFactory{
-			reader: r.reader,
+			reader: reader,
 		}
 	}
 
 	resIterator := &iterator{
+		reader:    reader,
 		position:  position,
 		cdbReader: r,
 		record: &record{
@@ -267,3 +490,22 @@ func (r *readerImpl) newIterator(position uint32, keySectionFactory, valueSectio
 
 	return resIterator, nil
 }
+
+// contextReaderAt binds a context to each ReadAt call of the underlying reader
+type contextReaderAt struct {
+	ctx    context.Context
+	reader io.ReaderAt
+}
+
+// ReadAt implements io.ReaderAt interface
+func (c *contextReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	if reader, ok := c.reader.(ReaderAtContext); ok {
+		return reader.ReadAtContext(c.ctx, p, off)
+	}
+
+	return c.reader.ReadAt(p, off)
+}
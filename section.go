@@ -0,0 +1,218 @@
+package cdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+// Optional data (filters, indexes, etc) is stored after the hash tables, so plain cdb readers just ignore it.
+//
+// The trailer starts with the magic "cdbx", the number of sections and a checksum (4 bytes each), which are
+// followed by a table of contents: tag and payload size (4 bytes each) of every section, then by payloads
+// in the order of the table. The checksum is CRC-32C of the database header, of the last bytes of the hash tables
+// and of the number of sections and the table of contents, so it binds the trailer to the database: stale bytes
+// of a previous, larger file written in place are not taken for a trailer. A trailer with a wrong checksum
+// is ignored, the database is readable without it. Unknown sections are skipped.
+const (
+	// Tag of the trailer start marker, "cdbx"
+	trailerMagic = 0x78626463
+	// Size of the start of the trailer: magic, number of sections, checksum
+	trailerHeaderSize = 12
+	// Max number of sections of a trailer
+	maxSections = 64
+	// Number of the last bytes of hash tables covered by the trailer checksum
+	trailerBindingSize = 64
+	// Tag of the section with a filter of keys, "filt"
+	filterSection = 0x746c6966
+	// Tag of the section with fingerprints of hash table slots, "fing"
+	fingerprintSection = 0x676e6966
+	// Tag of the section with positions of records sorted by key, "indx"
+	indexSection = 0x78646e69
+	// Tag of the section with names of codecs of keys and values, "codc"
+	codecSection = 0x63646f63
+)
+
+// ErrInvalidTrailer tells that optional data after the hash tables is corrupted
+var ErrInvalidTrailer = errors.New("invalid cdb trailer")
+
+// castagnoli is the CRC-32C table of trailer checksums
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// section is a pointer to the payload of a trailer section
+type section struct {
+	position int64
+	size     uint32
+}
+
+// extension is a trailer section to be written
+type extension struct {
+	tag  uint32
+	data []byte
+	// spilled is the start of the payload kept in a temporary file, data follows it
+	spilled *io.SectionReader
+}
+
+// size returns the size of the payload
+func (ext extension) size() int64 {
+	size := int64(len(ext.data))
+	if ext.spilled != nil {
+		size += ext.spilled.Size()
+	}
+
+	return size
+}
+
+// trailer describes sections stored after the hash tables
+type trailer struct {
+	sections map[uint32]section
+	// present tells if the trailer exists, end is the position after it (the end of the hash tables if it does not)
+	present bool
+	end     int64
+	// binding is the checksum of the header and of the end of the hash tables
+	binding uint32
+}
+
+// readTrailer reads the table of contents of the trailer which starts at the end of the hash tables
+// of the given total size, headerSum is the checksum of the database header. Payloads of sections
+// are not read, but it is checked that they fit in the file.
+func readTrailer(reader io.ReaderAt, headerSum uint32, tablesEnd, tablesSize int64) (trailer, error) {
+	var (
+		bindingSize = min(int64(trailerBindingSize), tablesSize)
+		buf         = make([]byte, bindingSize+trailerHeaderSize)
+		t           = trailer{sections: make(map[uint32]section), end: tablesEnd}
+	)
+
+	n, err := reader.ReadAt(buf, tablesEnd-bindingSize)
+	if err != nil && err != io.EOF {
+		return t, err
+	}
+
+	t.binding = crc32.Update(headerSum, castagnoli, buf[:min(int64(n), bindingSize)])
+
+	if n < len(buf) {
+		return t, nil
+	}
+
+	head := buf[bindingSize:]
+	count, sum := binary.LittleEndian.Uint32(head[4:]), binary.LittleEndian.Uint32(head[8:])
+
+	if binary.LittleEndian.Uint32(head) != trailerMagic || count > maxSections {
+		return t, nil
+	}
+
+	contents := make([]byte, 4+count*8)
+	copy(contents, head[4:8])
+
+	if n, err := reader.ReadAt(contents[4:], tablesEnd+trailerHeaderSize); n < len(contents)-4 {
+		if err == io.EOF {
+			return t, nil
+		}
+
+		return t, err
+	}
+
+	if crc32.Update(t.binding, castagnoli, contents) != sum {
+		return t, nil
+	}
+
+	position := tablesEnd + trailerHeaderSize + int64(len(contents)-4)
+
+	for i := 4; i < len(contents); i += 8 {
+		tag, size := binary.LittleEndian.Uint32(contents[i:]), binary.LittleEndian.Uint32(contents[i+4:])
+
+		if _, ok := t.sections[tag]; ok {
+			return t, ErrInvalidTrailer
+		}
+
+		t.sections[tag] = section{position, size}
+		position += int64(size)
+	}
+
+	// payloads are read on demand, so their sizes are checked against the file before anything is allocated.
+	// A reader may return io.EOF along with the last byte, so the number of read bytes decides.
+	if position > tablesEnd+trailerHeaderSize {
+		if n, err := reader.ReadAt(make([]byte, 1), position-1); n == 0 {
+			if err == nil || err == io.EOF {
+				return t, ErrInvalidTrailer
+			}
+
+			return t, err
+		}
+	}
+
+	t.present, t.end = true, position
+
+	return t, nil
+}
+
+// read returns the payload of the section
+func (s section) read(reader io.ReaderAt) ([]byte, error) {
+	data := make([]byte, s.size)
+	n, err := reader.ReadAt(data, s.position)
+
+	if err == io.EOF && n == len(data) {
+		err = nil
+	}
+	if err == io.EOF {
+		err = ErrInvalidTrailer
+	}
+
+	return data, err
+}
+
+// writeSections writes the trailer with the given sections, binding is the checksum of the header
+// and of the end of the hash tables
+func writeSections(writer io.Writer, extensions []extension, binding uint32) error {
+	if len(extensions) > maxSections {
+		return ErrInvalidTrailer
+	}
+
+	contents := appendUint32(make([]byte, 0, 4+len(extensions)*8), uint32(len(extensions)))
+
+	for _, ext := range extensions {
+		if ext.size() > maxUint {
+			return ErrOutOfMemory
+		}
+
+		contents = appendPair(contents, ext.tag, uint32(ext.size()))
+	}
+
+	head := appendPair(nil, trailerMagic, uint32(len(extensions)))
+	head = appendUint32(head, crc32.Update(binding, castagnoli, contents))
+
+	if _, err := writer.Write(append(head, contents[4:]...)); err != nil {
+		return err
+	}
+
+	for _, ext := range extensions {
+		if ext.spilled != nil {
+			if _, err := io.Copy(writer, ext.spilled); err != nil {
+				return err
+			}
+		}
+
+		if _, err := writer.Write(ext.data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// trailerBinding returns the checksum of the header and of the given end of the hash tables
+func trailerBinding(header, tablesTail []byte) uint32 {
+	return crc32.Update(crc32.Checksum(header, castagnoli), castagnoli, tablesTail)
+}
+
+// appendTail returns the last trailerBindingSize bytes of tail followed by data
+func appendTail(tail, data []byte) []byte {
+	tail = append(tail, data[max(0, len(data)-trailerBindingSize):]...)
+
+	if len(tail) > trailerBindingSize {
+		tail = append(tail[:0], tail[len(tail)-trailerBindingSize:]...)
+	}
+
+	return tail
+}
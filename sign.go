@@ -0,0 +1,208 @@
+package cdb
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// A signed database has the signature block right after the trailer: the "sign" tag, the payload size,
+// the public key and the Ed25519ph signature of the SHA-512 digest of the file up to the block, i.e. of the header,
+// records, hash tables and the trailer. Bytes after the block are not a part of the database.
+
+const (
+	// Tag of the signature block, "sign"
+	signatureSection = 0x6e676973
+	// Size of the payload of the signature block: public key, signature
+	signatureSectionSize = ed25519.PublicKeySize + ed25519.SignatureSize
+	// Context of signatures, it separates signatures of databases from other signatures of the same key
+	signatureContext = "cdb database"
+)
+
+var (
+	// ErrUnsigned tells that a database opened with trusted keys is not signed
+	ErrUnsigned = errors.New("cdb database is not signed")
+	// ErrUntrustedKey tells that a database is signed by a key which is not trusted
+	ErrUntrustedKey = errors.New("cdb database is signed by an untrusted key")
+	// ErrInvalidSignature tells that a database was modified after it was signed
+	ErrInvalidSignature = errors.New("cdb signature does not match the database")
+)
+
+// SetSigningKey tells the cdb to sign new databases with the given key on Close. The database is read back
+// to compute its digest, so the io.WriteSeeker given to GetWriter must implement io.ReaderAt (like *os.File).
+// Nil disables signing. Given value will be used only for new instances of Writer.
+func (cdb *CDB) SetSigningKey(key ed25519.PrivateKey) {
+	cdb.signingKey = key
+}
+
+// SetTrustedKeys tells the cdb to open only databases signed by one of the given keys, GetReader reads
+// the whole database to verify its signature and returns ErrUnsigned, ErrUntrustedKey or ErrInvalidSignature.
+// The signature is checked once, when the database is opened: later reads are not verified again,
+// so the file must not be modified while the Reader is used.
+// No keys disable verification. Given value will be used only for new instances of Reader.
+func (cdb *CDB) SetTrustedKeys(keys ...ed25519.PublicKey) {
+	cdb.trustedKeys = keys
+}
+
+// Sign signs the database with the given key, or replaces its signature. The signature is written
+// after the trailer (an empty trailer is added if there is none) over the previous one, if any.
+func Sign(file interface {
+	io.ReaderAt
+	io.WriterAt
+}, key ed25519.PrivateKey) error {
+	r, err := newReader(file, nil)
+	if err != nil {
+		return err
+	}
+
+	t, err := r.readTrailer()
+	if err != nil {
+		return err
+	}
+
+	if !t.present {
+		var buf bytes.Buffer
+
+		if err := writeSections(&buf, nil, t.binding); err != nil {
+			return err
+		}
+
+		if _, err := file.WriteAt(buf.Bytes(), t.end); err != nil {
+			return err
+		}
+
+		t.end += int64(buf.Len())
+	}
+
+	data, err := signDigest(file, t.end, key)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.WriteAt(data, t.end)
+
+	return err
+}
+
+// readSignature returns the payload of the signature which follows the trailer, nil if there is no signature
+func readSignature(reader io.ReaderAt, t trailer) ([]byte, error) {
+	if !t.present {
+		return nil, nil
+	}
+
+	data := make([]byte, 8+signatureSectionSize)
+
+	n, err := reader.ReadAt(data, t.end)
+	if n < len(data) {
+		if err == io.EOF {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	if binary.LittleEndian.Uint32(data) != signatureSection || binary.LittleEndian.Uint32(data[4:]) != signatureSectionSize {
+		return nil, nil
+	}
+
+	return data[8:], nil
+}
+
+// signDigest returns the signature block of the first size bytes of the database
+func signDigest(reader io.ReaderAt, size int64, key ed25519.PrivateKey) ([]byte, error) {
+	digest, err := digestOf(reader, size)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := key.Sign(nil, digest, &ed25519.Options{Hash: crypto.SHA512, Context: signatureContext})
+	if err != nil {
+		return nil, err
+	}
+
+	data := appendPair(make([]byte, 0, 8+signatureSectionSize), signatureSection, signatureSectionSize)
+	data = append(data, key.Public().(ed25519.PublicKey)...)
+
+	return append(data, signature...), nil
+}
+
+// digestOf returns the SHA-512 digest of the first size bytes of the database
+func digestOf(reader io.ReaderAt, size int64) ([]byte, error) {
+	hash := sha512.New()
+
+	if _, err := io.Copy(hash, io.NewSectionReader(reader, 0, size)); err != nil {
+		return nil, err
+	}
+
+	return hash.Sum(nil), nil
+}
+
+// verifySignature checks that the database is signed by one of the trusted keys. Only the header,
+// the table of contents of the trailer and the signature block are parsed before the digest is checked.
+func verifySignature(reader io.ReaderAt, trusted []ed25519.PublicKey) error {
+	r, err := newReader(reader, nil)
+	if err != nil {
+		return err
+	}
+
+	t, err := r.readTrailer()
+	if err != nil {
+		return err
+	}
+
+	data, err := readSignature(reader, t)
+	if err != nil {
+		return err
+	}
+
+	if data == nil {
+		return ErrUnsigned
+	}
+
+	publicKey, signature := ed25519.PublicKey(data[:ed25519.PublicKeySize]), data[ed25519.PublicKeySize:]
+
+	if !isTrusted(publicKey, trusted) {
+		return ErrUntrustedKey
+	}
+
+	digest, err := digestOf(reader, t.end)
+	if err != nil {
+		return err
+	}
+
+	options := &ed25519.Options{Hash: crypto.SHA512, Context: signatureContext}
+	if ed25519.VerifyWithOptions(publicKey, digest, signature, options) != nil {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// isTrusted tells if the key is one of the trusted keys
+func isTrusted(key ed25519.PublicKey, trusted []ed25519.PublicKey) bool {
+	for _, k := range trusted {
+		if bytes.Equal(k, key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sign appends the signature block to the database written up to the given offset, returns the new offset
+func (w *writerImpl) sign(offset int64) (int64, error) {
+	data, err := signDigest(w.writer.(io.ReaderAt), offset, w.signingKey)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := w.writer.Write(data); err != nil {
+		return 0, err
+	}
+
+	return offset + int64(len(data)), nil
+}
@@ -0,0 +1,173 @@
+package cdb
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"io"
+)
+
+// newSigningKey returns a key generated from the given seed byte
+func newSigningKey(seed byte) ed25519.PrivateKey {
+	return ed25519.NewKeyFromSeed(bytes.Repeat([]byte{seed}, ed25519.SeedSize))
+}
+
+// publicKey returns the public key of the private key
+func publicKey(key ed25519.PrivateKey) ed25519.PublicKey {
+	return key.Public().(ed25519.PublicKey)
+}
+
+// openTrusted opens the test database with the given trusted keys
+func (suite *CDBTestSuite) openTrusted(keys ...ed25519.PublicKey) (Reader, error) {
+	suite.cdbHandle.SetTrustedKeys(keys...)
+	return suite.cdbHandle.GetReader(suite.cdbFile)
+}
+
+func (suite *CDBTestSuite) TestSignedDatabase() {
+	key := newSigningKey(1)
+	suite.cdbHandle.SetSigningKey(key)
+	suite.fillTestCDB()
+
+	reader, err := suite.openTrusted(publicKey(newSigningKey(2)), publicKey(key))
+	suite.Require().Nil(err)
+
+	value, err := reader.Get(suite.testRecords[0].key)
+	suite.Nil(err)
+	suite.Equal(suite.testRecords[0].val, value)
+
+	_, err = suite.openTrusted(publicKey(newSigningKey(2)))
+	suite.Equal(ErrUntrustedKey, err)
+
+	// plain readers ignore the signature
+	_, err = suite.openTrusted()
+	suite.Nil(err)
+}
+
+func (suite *CDBTestSuite) TestSignedDatabaseWithSections() {
+	key := newSigningKey(1)
+	suite.cdbHandle.SetSigningKey(key)
+	suite.cdbHandle.SetFilter(10)
+	suite.cdbHandle.SetIndex(true)
+	suite.fillTestCDB()
+
+	reader, err := suite.openTrusted(publicKey(key))
+	suite.Require().Nil(err)
+
+	iterator, err := reader.Prefix([]byte("key1"))
+	suite.Require().Nil(err)
+	suite.Equal([]string{"key1"}, suite.collectKeys(iterator))
+}
+
+func (suite *CDBTestSuite) TestUnsignedDatabase() {
+	suite.fillTestCDB()
+
+	_, err := suite.openTrusted(publicKey(newSigningKey(1)))
+	suite.Equal(ErrUnsigned, err)
+}
+
+func (suite *CDBTestSuite) TestTamperedSignedDatabase() {
+	key := newSigningKey(1)
+	suite.cdbHandle.SetSigningKey(key)
+	suite.fillTestCDB()
+
+	// flip a byte of the first value
+	position := int64(tablesRefsSize + 8 + len(suite.testRecords[0].key))
+	b := make([]byte, 1)
+
+	_, err := suite.cdbFile.ReadAt(b, position)
+	suite.Require().Nil(err)
+	b[0] ^= 1
+	_, err = suite.cdbFile.WriteAt(b, position)
+	suite.Require().Nil(err)
+
+	_, err = suite.openTrusted(publicKey(key))
+	suite.Equal(ErrInvalidSignature, err)
+}
+
+func (suite *CDBTestSuite) TestTamperedDatabaseIsNotCached() {
+	key := newSigningKey(1)
+	suite.cdbHandle.SetSigningKey(key)
+	suite.cdbHandle.SetFilter(10)
+	suite.fillTestCDB()
+
+	// flip a byte of the first key
+	position := int64(tablesRefsSize + 8)
+	b := make([]byte, 1)
+
+	_, err := suite.cdbFile.ReadAt(b, position)
+	suite.Require().Nil(err)
+	b[0] ^= 1
+	_, err = suite.cdbFile.WriteAt(b, position)
+	suite.Require().Nil(err)
+
+	// the signature is verified before the block cache or sections are used
+	cache := NewBlockCache(1<<20, 64, LRU)
+	suite.cdbHandle.SetBlockCache(cache)
+
+	_, err = suite.openTrusted(publicKey(key))
+	suite.Equal(ErrInvalidSignature, err)
+	suite.Equal(CacheStats{}, cache.Stats())
+}
+
+func (suite *CDBTestSuite) TestAppendedSignedDatabase() {
+	key := newSigningKey(1)
+	suite.cdbHandle.SetSigningKey(key)
+	suite.fillTestCDB()
+
+	end, err := suite.cdbFile.Seek(0, io.SeekEnd)
+	suite.Require().Nil(err)
+
+	// bytes after the signature are not a part of the database
+	_, err = suite.cdbFile.WriteAt(appendPair(nil, 0x74736574, 0), end)
+	suite.Require().Nil(err)
+
+	_, err = suite.openTrusted(publicKey(key))
+	suite.Nil(err)
+}
+
+func (suite *CDBTestSuite) TestSign() {
+	for _, withFilter := range []bool{false, true} {
+		_, err := suite.cdbFile.Seek(0, io.SeekStart)
+		suite.Require().Nil(err)
+
+		if withFilter {
+			suite.cdbHandle.SetFilter(10)
+		}
+
+		suite.fillTestCDB()
+
+		first, second := newSigningKey(1), newSigningKey(2)
+		suite.Require().Nil(Sign(suite.cdbFile, first))
+
+		_, err = suite.openTrusted(publicKey(first))
+		suite.Nil(err)
+
+		info, err := suite.cdbFile.Stat()
+		suite.Require().Nil(err)
+
+		// the signature is replaced in place
+		suite.Require().Nil(Sign(suite.cdbFile, second))
+
+		resigned, err := suite.cdbFile.Stat()
+		suite.Require().Nil(err)
+		suite.Equal(info.Size(), resigned.Size())
+
+		_, err = suite.openTrusted(publicKey(first))
+		suite.Equal(ErrUntrustedKey, err)
+
+		reader, err := suite.openTrusted(publicKey(second))
+		suite.Require().Nil(err)
+
+		value, err := reader.Get(suite.testRecords[1].key)
+		suite.Nil(err)
+		suite.Equal(suite.testRecords[1].val, value)
+
+		suite.cdbHandle.SetTrustedKeys()
+	}
+}
+
+func (suite *CDBTestSuite) TestSigningRequiresReadableWriter() {
+	suite.cdbHandle.SetSigningKey(newSigningKey(1))
+
+	_, err := suite.cdbHandle.GetWriter(struct{ io.WriteSeeker }{suite.cdbFile})
+	suite.Equal(ErrWriterNotReadable, err)
+}
@@ -0,0 +1,325 @@
+package cdb
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Default size of an in-memory run of recordSorter
+const defaultRunSize = 64 << 20
+
+// sortRecord is a record buffered by recordSorter
+type sortRecord struct {
+	hash       uint32
+	seq        uint64
+	key, value []byte
+}
+
+// recordLess defines the order of records of recordSorter
+type recordLess func(a, b *sortRecord) bool
+
+// recordSorter is an external sort of records. Records are collected in memory runs of runSize bytes,
+// full runs are sorted and spilled to temporary files in background (at most spillers at the same time),
+// then all runs are merged.
+// recordSorter is not safe for concurrent use.
+type recordSorter struct {
+	less     recordLess
+	runSize  int
+	tempDir  string
+	run      []sortRecord
+	size     int
+	runs     []*os.File
+	spilling sync.WaitGroup
+	spillers chan struct{}
+
+	mu  sync.Mutex
+	err error
+}
+
+// newRecordSorter returns a new instance of recordSorter
+func newRecordSorter(less recordLess, runSize, spillers int, tempDir string) *recordSorter {
+	if runSize <= 0 {
+		runSize = defaultRunSize
+	}
+
+	if spillers < 1 {
+		spillers = 1
+	}
+
+	return &recordSorter{
+		less:     less,
+		runSize:  runSize,
+		tempDir:  tempDir,
+		spillers: make(chan struct{}, spillers),
+	}
+}
+
+// add buffers the given record. Key and value are not copied.
+func (s *recordSorter) add(rec sortRecord) error {
+	if err := s.failure(); err != nil {
+		return err
+	}
+
+	s.run = append(s.run, rec)
+	s.size += len(rec.key) + len(rec.value) + 40
+
+	if s.size >= s.runSize {
+		run := s.run
+		s.run, s.size = nil, 0
+
+		s.spillers <- struct{}{}
+		s.spilling.Add(1)
+
+		go func() {
+			defer func() {
+				<-s.spillers
+				s.spilling.Done()
+			}()
+
+			s.spill(run)
+		}()
+	}
+
+	return nil
+}
+
+// spill sorts the given run and writes it to a temporary file
+func (s *recordSorter) spill(run []sortRecord) {
+	s.sort(run)
+
+	f, err := os.CreateTemp(s.tempDir, "cdb_run_*")
+	if err != nil {
+		s.fail(err)
+		return
+	}
+
+	s.mu.Lock()
+	s.runs = append(s.runs, f)
+	s.mu.Unlock()
+
+	buffer := bufio.NewWriter(f)
+	header := make([]byte, 20)
+
+	for i := range run {
+		rec := &run[i]
+
+		binary.LittleEndian.PutUint32(header, rec.hash)
+		binary.LittleEndian.PutUint64(header[4:], rec.seq)
+		binary.LittleEndian.PutUint32(header[12:], uint32(len(rec.key)))
+		binary.LittleEndian.PutUint32(header[16:], uint32(len(rec.value)))
+
+		if _, err := buffer.Write(header); err != nil {
+			s.fail(err)
+			return
+		}
+
+		if _, err := buffer.Write(rec.key); err != nil {
+			s.fail(err)
+			return
+		}
+
+		if _, err := buffer.Write(rec.value); err != nil {
+			s.fail(err)
+			return
+		}
+	}
+
+	if err := buffer.Flush(); err != nil {
+		s.fail(err)
+		return
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		s.fail(err)
+	}
+}
+
+// sort sorts the given run in memory
+func (s *recordSorter) sort(run []sortRecord) {
+	sort.Slice(run, func(i, j int) bool {
+		return s.less(&run[i], &run[j])
+	})
+}
+
+// fail remembers the first error of background spills
+func (s *recordSorter) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+// failure returns the first error of background spills
+func (s *recordSorter) failure() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.err
+}
+
+// merge calls fn for each record in sorted order. The record is valid only during the call.
+func (s *recordSorter) merge(fn func(rec *sortRecord) error) error {
+	s.spilling.Wait()
+
+	if err := s.failure(); err != nil {
+		return err
+	}
+
+	s.sort(s.run)
+
+	sources := &mergeHeap{less: s.less}
+	memory := &memoryRun{records: s.run}
+
+	if err := sources.push(memory); err != nil {
+		return err
+	}
+
+	for _, f := range s.runs {
+		if err := sources.push(&fileRun{reader: bufio.NewReader(f)}); err != nil {
+			return err
+		}
+	}
+
+	for sources.Len() > 0 {
+		source := sources.sources[0]
+
+		if err := fn(&source.current); err != nil {
+			return err
+		}
+
+		ok, err := source.run.next(&source.current)
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			heap.Fix(sources, 0)
+		} else {
+			heap.Pop(sources)
+		}
+	}
+
+	return nil
+}
+
+// close removes temporary files
+func (s *recordSorter) close() error {
+	s.spilling.Wait()
+
+	var err error
+
+	for _, f := range s.runs {
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+
+		if rerr := os.Remove(f.Name()); rerr != nil && err == nil {
+			err = rerr
+		}
+	}
+
+	s.runs, s.run = nil, nil
+
+	return err
+}
+
+// sortedRun is a source of sorted records
+type sortedRun interface {
+	// next reads the next record into rec, returns false if there are no more records
+	next(rec *sortRecord) (bool, error)
+}
+
+// memoryRun implements sortedRun for a sorted slice
+type memoryRun struct {
+	records []sortRecord
+}
+
+func (r *memoryRun) next(rec *sortRecord) (bool, error) {
+	if len(r.records) == 0 {
+		return false, nil
+	}
+
+	*rec, r.records = r.records[0], r.records[1:]
+
+	return true, nil
+}
+
+// fileRun implements sortedRun for a spilled run
+type fileRun struct {
+	reader *bufio.Reader
+	header [20]byte
+}
+
+func (r *fileRun) next(rec *sortRecord) (bool, error) {
+	if _, err := io.ReadFull(r.reader, r.header[:]); err != nil {
+		if err == io.EOF {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	rec.hash = binary.LittleEndian.Uint32(r.header[:])
+	rec.seq = binary.LittleEndian.Uint64(r.header[4:])
+	keySize := binary.LittleEndian.Uint32(r.header[12:])
+	valSize := binary.LittleEndian.Uint32(r.header[16:])
+
+	data := make([]byte, int(keySize)+int(valSize))
+	if _, err := io.ReadFull(r.reader, data); err != nil {
+		return false, err
+	}
+
+	rec.key, rec.value = data[:keySize:keySize], data[keySize:]
+
+	return true, nil
+}
+
+// mergeSource is a sorted run with its current record
+type mergeSource struct {
+	run     sortedRun
+	current sortRecord
+}
+
+// mergeHeap implements heap.Interface, it orders runs by their current records
+type mergeHeap struct {
+	less    recordLess
+	sources []*mergeSource
+}
+
+// push adds the given run to the heap if it is not empty
+func (h *mergeHeap) push(run sortedRun) error {
+	source := &mergeSource{run: run}
+
+	ok, err := run.next(&source.current)
+	if err != nil || !ok {
+		return err
+	}
+
+	heap.Push(h, source)
+
+	return nil
+}
+
+func (h *mergeHeap) Len() int { return len(h.sources) }
+
+func (h *mergeHeap) Less(i, j int) bool {
+	return h.less(&h.sources[i].current, &h.sources[j].current)
+}
+
+func (h *mergeHeap) Swap(i, j int) { h.sources[i], h.sources[j] = h.sources[j], h.sources[i] }
+
+func (h *mergeHeap) Push(x interface{}) { h.sources = append(h.sources, x.(*mergeSource)) }
+
+func (h *mergeHeap) Pop() interface{} {
+	last := h.sources[len(h.sources)-1]
+	h.sources = h.sources[:len(h.sources)-1]
+
+	return last
+}
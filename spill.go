@@ -0,0 +1,226 @@
+package cdb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"os"
+	"sort"
+)
+
+// slotSpill keeps slot lists of hash tables in a temporary file, so a writer with a memory limit
+// holds only recently added slots in memory. On Close slot lists are read back one table at a time.
+// Key hashes of the filter are spilled along with slots, and the fingerprint section is spilled on Close.
+type slotSpill struct {
+	file   *os.File
+	buffer *bufio.Writer
+	offset int64
+	chunks [tableNum][]spillChunk
+	// counts are numbers of spilled slots of each table
+	counts [tableNum]uint32
+	// hashes are chunks of key hashes of the filter, 8 bytes each
+	hashes []spillChunk
+}
+
+// spillChunk is a part of a slot list of a hash table stored in the temporary file:
+// slots (8 bytes each), then fingerprints (4 bytes each) if any. first is the number of its first slot
+// among spilled slots of the table.
+type spillChunk struct {
+	offset          int64
+	first, count    uint32
+	hasFingerprints bool
+}
+
+// newSlotSpill returns a new instance of slotSpill with a temporary file in the given directory
+func newSlotSpill(dir string) (*slotSpill, error) {
+	f, err := os.CreateTemp(dir, "cdb_slots_*")
+	if err != nil {
+		return nil, err
+	}
+
+	return &slotSpill{
+		file:   f,
+		buffer: bufio.NewWriter(f),
+	}, nil
+}
+
+// write appends the given slots (and fingerprints) of the i-th table to the file
+func (s *slotSpill) write(i int, table hashTable, fingerprints []uint32) error {
+	chunk := spillChunk{
+		offset:          s.offset,
+		first:           s.counts[i],
+		count:           uint32(len(table)),
+		hasFingerprints: fingerprints != nil,
+	}
+
+	buf := make([]byte, 0, len(table)*(slotSize+4))
+
+	for _, slot := range table {
+		buf = appendPair(buf, slot.hash, slot.position)
+	}
+
+	for _, fp := range fingerprints {
+		buf = appendUint32(buf, fp)
+	}
+
+	s.chunks[i] = append(s.chunks[i], chunk)
+	s.counts[i] += chunk.count
+
+	return s.append(buf)
+}
+
+// writeHashes appends the given key hashes to the file
+func (s *slotSpill) writeHashes(hashes []uint64) error {
+	buf := make([]byte, 0, len(hashes)*8)
+
+	for _, h := range hashes {
+		buf = appendUint32(appendUint32(buf, uint32(h)), uint32(h>>32))
+	}
+
+	s.hashes = append(s.hashes, spillChunk{offset: s.offset, count: uint32(len(hashes))})
+
+	return s.append(buf)
+}
+
+// hashCount returns the number of spilled key hashes
+func (s *slotSpill) hashCount() int {
+	n := 0
+	for _, chunk := range s.hashes {
+		n += int(chunk.count)
+	}
+
+	return n
+}
+
+// forEachHash calls fn for each spilled key hash. flush should be called before.
+func (s *slotSpill) forEachHash(fn func(h uint64)) error {
+	for _, chunk := range s.hashes {
+		buf := make([]byte, int(chunk.count)*8)
+		if _, err := s.file.ReadAt(buf, chunk.offset); err != nil {
+			return err
+		}
+
+		for j := 0; j < len(buf); j += 8 {
+			fn(binary.LittleEndian.Uint64(buf[j:]))
+		}
+	}
+
+	return nil
+}
+
+// append appends the given data to the file
+func (s *slotSpill) append(data []byte) error {
+	if _, err := s.buffer.Write(data); err != nil {
+		return err
+	}
+
+	s.offset += int64(len(data))
+
+	return nil
+}
+
+// flush makes written slots available for read
+func (s *slotSpill) flush() error {
+	return s.buffer.Flush()
+}
+
+// spillSnapshot is a read-only view of slot lists spilled so far. Hash tables are built from it
+// by several goroutines while the fingerprint section is spilled to the same file.
+type spillSnapshot struct {
+	file   io.ReaderAt
+	chunks [tableNum][]spillChunk
+}
+
+// snapshot returns a view of slot lists spilled so far. flush should be called before.
+func (s *slotSpill) snapshot() *spillSnapshot {
+	return &spillSnapshot{file: s.file, chunks: s.chunks}
+}
+
+// read returns spilled slots (and fingerprints) of the i-th table in the order they were added
+func (s *spillSnapshot) read(i int) (hashTable, []uint32, error) {
+	var (
+		table        hashTable
+		fingerprints []uint32
+	)
+
+	for _, chunk := range s.chunks[i] {
+		size := int(chunk.count) * slotSize
+		if chunk.hasFingerprints {
+			size += int(chunk.count) * 4
+		}
+
+		buf := make([]byte, size)
+		if _, err := s.file.ReadAt(buf, chunk.offset); err != nil {
+			return nil, nil, err
+		}
+
+		for j := 0; j < int(chunk.count); j++ {
+			table = append(table, slot{
+				hash:     binary.LittleEndian.Uint32(buf[j*slotSize:]),
+				position: binary.LittleEndian.Uint32(buf[j*slotSize+4:]),
+			})
+		}
+
+		if chunk.hasFingerprints {
+			buf = buf[int(chunk.count)*slotSize:]
+
+			for j := 0; j < int(chunk.count); j++ {
+				fingerprints = append(fingerprints, binary.LittleEndian.Uint32(buf[j*4:]))
+			}
+		}
+	}
+
+	return table, fingerprints, nil
+}
+
+// slotOffset returns the offset of the n-th spilled slot of the i-th table in the file
+func (s *slotSpill) slotOffset(i int, n uint32) int64 {
+	chunks := s.chunks[i]
+	j := sort.Search(len(chunks), func(j int) bool { return chunks[j].first+chunks[j].count > n })
+
+	return chunks[j].offset + int64(n-chunks[j].first)*slotSize
+}
+
+// readUint32 reads 4 bytes at the given offset of the file, the buffer is flushed if they are still in it
+func (s *slotSpill) readUint32(offset int64) (uint32, error) {
+	if err := s.flushUntil(offset + 4); err != nil {
+		return 0, err
+	}
+
+	buf := make([]byte, 4)
+	if _, err := s.file.ReadAt(buf, offset); err != nil {
+		return 0, err
+	}
+
+	return binary.LittleEndian.Uint32(buf), nil
+}
+
+// writeUint32 overwrites 4 bytes at the given offset of the file, the buffer is flushed if they are still in it
+func (s *slotSpill) writeUint32(a uint32, offset int64) error {
+	if err := s.flushUntil(offset + 4); err != nil {
+		return err
+	}
+
+	_, err := s.file.WriteAt(appendUint32(nil, a), offset)
+	return err
+}
+
+// flushUntil flushes the buffer if it holds bytes before the given offset
+func (s *slotSpill) flushUntil(offset int64) error {
+	if offset > s.offset-int64(s.buffer.Buffered()) {
+		return s.flush()
+	}
+
+	return nil
+}
+
+// close removes the temporary file
+func (s *slotSpill) close() error {
+	err := s.file.Close()
+
+	if rerr := os.Remove(s.file.Name()); err == nil {
+		err = rerr
+	}
+
+	return err
+}
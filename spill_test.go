@@ -0,0 +1,122 @@
+package cdb
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strconv"
+)
+
+func (suite *CDBTestSuite) TestMemoryLimit() {
+	for i := 0; i < 1000; i++ {
+		stri := strconv.Itoa(i)
+		suite.testRecords = append(suite.testRecords, testCDBRecord{
+			key: []byte("item" + stri),
+			val: []byte("value" + stri),
+		})
+	}
+
+	suite.cdbHandle.SetFingerprints(true)
+	suite.cdbHandle.SetFilter(10)
+	suite.fillTestCDB()
+
+	expected, err := ioutil.ReadFile(suite.cdbFile.Name())
+	suite.Require().Nil(err)
+
+	dir, err := ioutil.TempDir("", "cdb_spill")
+	suite.Require().Nil(err)
+	defer os.RemoveAll(dir)
+
+	suite.cdbHandle.SetTempDir(dir)
+	suite.cdbHandle.SetMemoryLimit(100)
+
+	suite.resetCDBFile()
+	writer := suite.getCDBWriter()
+	for _, rec := range suite.testRecords {
+		suite.Require().Nil(writer.Put(rec.key, rec.val))
+	}
+
+	impl := writer.(*writerImpl)
+	suite.NotNil(impl.spill, "slots should be spilled to disk")
+	suite.Less(len(impl.keyHashes)*8, 100, "key hashes should be spilled to disk")
+	suite.Require().Nil(writer.Close())
+	suite.Positive(impl.spilledFingerprints, "fingerprints should be spilled to disk")
+	suite.LessOrEqual(len(impl.fingerprintData), 100)
+
+	actual, err := ioutil.ReadFile(suite.cdbFile.Name())
+	suite.Require().Nil(err)
+	suite.True(bytes.Equal(expected, actual), "spilling must not change the database")
+
+	files, err := ioutil.ReadDir(dir)
+	suite.Nil(err)
+	suite.Empty(files, "temporary files should be removed")
+}
+
+func (suite *CDBTestSuite) TestMemoryLimitWithWorkers() {
+	for i := 0; i < 1000; i++ {
+		stri := strconv.Itoa(i)
+		suite.testRecords = append(suite.testRecords, testCDBRecord{
+			key: []byte("item" + stri),
+			val: []byte("value" + stri),
+		})
+	}
+
+	suite.cdbHandle.SetFingerprints(true)
+	suite.fillTestCDB()
+
+	expected, err := ioutil.ReadFile(suite.cdbFile.Name())
+	suite.Require().Nil(err)
+
+	// tables are built from spilled slots while fingerprints are spilled
+	suite.cdbHandle.SetMemoryLimit(100)
+	suite.resetCDBFile()
+
+	writer := suite.getCDBWriter()
+	writer.(*writerImpl).workers = 4
+
+	for _, rec := range suite.testRecords {
+		suite.Require().Nil(writer.Put(rec.key, rec.val))
+	}
+
+	suite.Require().Nil(writer.Close())
+	suite.Positive(writer.(*writerImpl).spilledFingerprints, "fingerprints should be spilled to disk")
+
+	actual, err := ioutil.ReadFile(suite.cdbFile.Name())
+	suite.Require().Nil(err)
+	suite.True(bytes.Equal(expected, actual), "spilling must not change the database")
+}
+
+func (suite *CDBTestSuite) TestMemoryLimitKeepsFirstValue() {
+	suite.cdbHandle.SetMemoryLimit(1)
+
+	writer := suite.getCDBWriter()
+	suite.Require().Nil(writer.Put([]byte("key"), []byte("first")))
+	suite.Require().Nil(writer.Put([]byte("key"), []byte("second")))
+	suite.Require().Nil(writer.Close())
+
+	value, err := suite.getCDBReader().Get([]byte("key"))
+	suite.Nil(err)
+	suite.Equal([]byte("first"), value)
+}
+
+func (suite *CDBTestSuite) TestStickyErrorRemovesTemporaryFiles() {
+	dir, err := ioutil.TempDir("", "cdb_spill")
+	suite.Require().Nil(err)
+	defer os.RemoveAll(dir)
+
+	suite.cdbHandle.SetTempDir(dir)
+	suite.cdbHandle.SetMemoryLimit(100)
+
+	writer := suite.getCDBWriter()
+	for i := 0; i < 100; i++ {
+		suite.Require().Nil(writer.Put([]byte("item"+strconv.Itoa(i)), []byte("value")))
+	}
+
+	suite.Require().NotNil(writer.(*writerImpl).spill, "slots should be spilled to disk")
+	suite.Equal(ErrValueSize, writer.PutReader([]byte("key"), bytes.NewReader(nil), 1))
+	suite.Equal(ErrValueSize, writer.Close())
+
+	files, err := ioutil.ReadDir(dir)
+	suite.Nil(err)
+	suite.Empty(files, "temporary files should be removed")
+}
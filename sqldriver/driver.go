@@ -0,0 +1,483 @@
+// Package sqldriver is a database/sql driver which exposes a constant database as a read-only table
+// of two columns, key and value. It is registered as "cdb", the data source name is a path of a file
+// with optional parameters:
+//
+//	db, err := sql.Open("cdb", "data.cdb?types=string")
+//	rows, err := db.Query("SELECT key, value FROM data LIMIT 10")
+//	row := db.QueryRow("SELECT value FROM data WHERE key = ?", "alice")
+//
+// Supported statements are SELECT <columns> FROM <table> [WHERE key = <operand>] [LIMIT <operand>],
+// where columns are *, key or value, the table name is ignored, and operands are literals or
+// placeholders (? or $N). A lookup by key returns all records of the key using hash tables,
+// other queries scan records in file order.
+//
+// Parameters:
+//
+//	types=bytes   columns are []byte (BLOB), the default
+//	types=string  columns are string (TEXT)
+package sqldriver
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/alldroll/cdb"
+)
+
+func init() {
+	sql.Register("cdb", &Driver{})
+}
+
+// ColumnType is a type of values of columns
+type ColumnType int
+
+const (
+	// Bytes columns are []byte
+	Bytes ColumnType = iota
+	// String columns are string
+	String
+)
+
+// Driver implements driver.Driver and driver.DriverContext
+type Driver struct{}
+
+// Open opens the database file for a new connection, which closes the file when it is closed.
+// sql.DB uses OpenConnector instead, so its connections share the file.
+func (d *Driver) Open(name string) (driver.Conn, error) {
+	c, err := openConnector(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &conn{reader: c.reader, types: c.types, closer: c.closer}, nil
+}
+
+// OpenConnector opens the database file, connections of the returned connector share it.
+// The file is closed when the connector (or sql.DB) is closed.
+func (d *Driver) OpenConnector(name string) (driver.Connector, error) {
+	return openConnector(name)
+}
+
+// openConnector opens the database file and returns a connector which owns it
+func openConnector(name string) (*connector, error) {
+	path, types, err := parseDSN(name)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := cdb.New().GetReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &connector{reader: reader, types: types, closer: f}, nil
+}
+
+// NewConnector returns a connector to the given reader for sql.OpenDB:
+//
+//	db := sql.OpenDB(sqldriver.NewConnector(reader, sqldriver.String))
+func NewConnector(reader cdb.Reader, types ColumnType) driver.Connector {
+	return &connector{reader: reader, types: types}
+}
+
+// parseDSN returns the path and parameters of the data source name
+func parseDSN(name string) (string, ColumnType, error) {
+	path, rawQuery, _ := strings.Cut(name, "?")
+
+	params, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return "", Bytes, fmt.Errorf("sqldriver: invalid parameters %q: %w", rawQuery, err)
+	}
+
+	types := Bytes
+
+	for param, values := range params {
+		value := values[len(values)-1]
+
+		switch {
+		case param == "types" && value == "bytes":
+			types = Bytes
+		case param == "types" && value == "string":
+			types = String
+		default:
+			return "", Bytes, fmt.Errorf("sqldriver: invalid parameter %s=%s", param, value)
+		}
+	}
+
+	return path, types, nil
+}
+
+// connector implements driver.Connector
+type connector struct {
+	reader cdb.Reader
+	types  ColumnType
+	closer io.Closer
+}
+
+// Connect returns a new connection to the database
+func (c *connector) Connect(context.Context) (driver.Conn, error) {
+	return &conn{reader: c.reader, types: c.types}, nil
+}
+
+// Driver returns the driver of the connector
+func (c *connector) Driver() driver.Driver {
+	return &Driver{}
+}
+
+// Close closes the database file, it is called by sql.DB.Close
+func (c *connector) Close() error {
+	if c.closer == nil {
+		return nil
+	}
+
+	return c.closer.Close()
+}
+
+// conn implements driver.Conn, it is stateless, so it is cheap
+type conn struct {
+	reader cdb.Reader
+	types  ColumnType
+	// closer is the database file opened by Driver.Open, nil if the database is shared by a connector
+	closer io.Closer
+}
+
+// Prepare parses the statement
+func (c *conn) Prepare(statement string) (driver.Stmt, error) {
+	q, err := parseQuery(statement)
+	if err != nil {
+		return nil, err
+	}
+
+	return &stmt{conn: c, query: q}, nil
+}
+
+// Close closes the database file opened by Driver.Open, a database shared by a connector stays open
+func (c *conn) Close() error {
+	if c.closer == nil {
+		return nil
+	}
+
+	return c.closer.Close()
+}
+
+// Begin starts a transaction, which is a no-op as the database is constant
+func (c *conn) Begin() (driver.Tx, error) {
+	return tx{}, nil
+}
+
+// tx implements driver.Tx
+type tx struct{}
+
+// Commit does nothing
+func (tx) Commit() error {
+	return nil
+}
+
+// Rollback does nothing
+func (tx) Rollback() error {
+	return nil
+}
+
+// stmt implements driver.Stmt and driver.StmtQueryContext
+type stmt struct {
+	conn  *conn
+	query *query
+}
+
+// Close does nothing
+func (s *stmt) Close() error {
+	return nil
+}
+
+// NumInput returns the number of placeholders
+func (s *stmt) NumInput() int {
+	return s.query.numInput
+}
+
+// Exec returns ErrReadOnly
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, ErrReadOnly
+}
+
+// Query executes the statement
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	named := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+
+	return s.QueryContext(context.Background(), named)
+}
+
+// QueryContext executes the statement, reads of scans are aborted as soon as ctx is done
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	limit := int64(-1)
+
+	if s.query.limit != nil {
+		value, err := s.query.limit.value(args)
+		if err != nil {
+			return nil, err
+		}
+
+		if limit, err = toLimit(value); err != nil {
+			return nil, err
+		}
+	}
+
+	base := rows{columns: s.query.columns, types: s.conn.types, limit: limit}
+
+	if s.query.key != nil {
+		value, err := s.query.key.value(args)
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := toKey(value)
+		if err != nil {
+			return nil, err
+		}
+
+		return s.lookup(ctx, base, key)
+	}
+
+	if limit == 0 || s.conn.reader.Size() == 0 {
+		return &base, nil
+	}
+
+	iterator, err := s.conn.reader.IteratorContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &scanRows{rows: base, iterator: iterator}, nil
+}
+
+// lookup returns rows of values of the key, values are read at once
+func (s *stmt) lookup(ctx context.Context, base rows, key []byte) (driver.Rows, error) {
+	r := &lookupRows{rows: base, key: key}
+
+	for value := range s.conn.reader.ValuesFor(key) {
+		if !r.take() {
+			break
+		}
+
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		r.values = append(r.values, value)
+	}
+
+	if err := s.conn.reader.Err(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// value returns the literal or the argument of the placeholder
+func (o *operand) value(args []driver.NamedValue) (driver.Value, error) {
+	if o.placeholder == 0 {
+		return o.literal, nil
+	}
+
+	for _, arg := range args {
+		if arg.Ordinal == o.placeholder {
+			return arg.Value, nil
+		}
+	}
+
+	return nil, fmt.Errorf("sqldriver: missing argument $%d", o.placeholder)
+}
+
+// toKey converts the value of an operand to a key
+func toKey(value driver.Value) ([]byte, error) {
+	switch v := value.(type) {
+	case []byte:
+		return bytes.Clone(v), nil
+	case string:
+		return []byte(v), nil
+	}
+
+	return nil, fmt.Errorf("sqldriver: key must be a string or []byte, got %T", value)
+}
+
+// toLimit converts the value of an operand to a limit
+func toLimit(value driver.Value) (int64, error) {
+	var (
+		limit int64
+		err   error
+	)
+
+	switch v := value.(type) {
+	case int64:
+		limit = v
+	case string:
+		_, err = fmt.Sscan(v, &limit)
+	default:
+		err = fmt.Errorf("got %T", value)
+	}
+
+	if err == nil && limit < 0 {
+		err = errors.New("negative value")
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("sqldriver: invalid limit: %w", err)
+	}
+
+	return limit, nil
+}
+
+// rows describes columns of a result, it is an empty result itself
+type rows struct {
+	columns []string
+	types   ColumnType
+	// limit is the number of rows which are left to return, -1 means no limit
+	limit int64
+}
+
+// Columns returns names of columns
+func (r *rows) Columns() []string {
+	return r.columns
+}
+
+// ColumnTypeDatabaseTypeName returns BLOB or TEXT
+func (r *rows) ColumnTypeDatabaseTypeName(int) string {
+	if r.types == String {
+		return "TEXT"
+	}
+
+	return "BLOB"
+}
+
+// ColumnTypeScanType returns []byte or string
+func (r *rows) ColumnTypeScanType(int) reflect.Type {
+	if r.types == String {
+		return reflect.TypeOf("")
+	}
+
+	return reflect.TypeOf([]byte(nil))
+}
+
+// Close does nothing
+func (r *rows) Close() error {
+	return nil
+}
+
+// Next returns io.EOF
+func (r *rows) Next([]driver.Value) error {
+	return io.EOF
+}
+
+// take reserves a row, returns false if the limit is reached
+func (r *rows) take() bool {
+	if r.limit == 0 {
+		return false
+	}
+
+	if r.limit > 0 {
+		r.limit--
+	}
+
+	return true
+}
+
+// fill sets values of columns of the row
+func (r *rows) fill(dest []driver.Value, key, value []byte) {
+	for i, column := range r.columns {
+		data := key
+		if column == columnValue {
+			data = value
+		}
+
+		if r.types == String {
+			dest[i] = string(data)
+		} else {
+			dest[i] = data
+		}
+	}
+}
+
+// lookupRows is a result of a lookup by key
+type lookupRows struct {
+	rows
+	key    []byte
+	values [][]byte
+}
+
+// Next fills the next row
+func (r *lookupRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+
+	r.fill(dest, r.key, r.values[0])
+	r.values = r.values[1:]
+
+	return nil
+}
+
+// scanRows is a result of a scan, records are read lazily by the iterator
+type scanRows struct {
+	rows
+	iterator cdb.Iterator
+	// started tells if the iterator has to be moved to return the next row
+	started bool
+}
+
+// Next fills the next row
+func (r *scanRows) Next(dest []driver.Value) error {
+	if !r.take() {
+		return io.EOF
+	}
+
+	if r.started {
+		ok, err := r.iterator.Next()
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			return io.EOF
+		}
+	}
+
+	r.started = true
+
+	key, err := r.iterator.Key()
+	if err != nil {
+		return err
+	}
+
+	var value []byte
+
+	for _, column := range r.columns {
+		if column == columnValue {
+			if value, err = r.iterator.Value(); err != nil {
+				return err
+			}
+
+			break
+		}
+	}
+
+	r.fill(dest, key, value)
+
+	return nil
+}
@@ -0,0 +1,248 @@
+package sqldriver
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alldroll/cdb"
+	"github.com/stretchr/testify/suite"
+)
+
+type DriverTestSuite struct {
+	suite.Suite
+	path string
+	db   *sql.DB
+}
+
+// record is a row of the table
+type record struct {
+	key, value string
+}
+
+func (suite *DriverTestSuite) SetupTest() {
+	suite.path = filepath.Join(suite.T().TempDir(), "test.cdb")
+	suite.writeDB(suite.path, []record{
+		{"a", "1"},
+		{"b", "2"},
+		{"a", "3"},
+		{"it's", "quoted"},
+	})
+
+	db, err := sql.Open("cdb", suite.path)
+	suite.Require().Nil(err)
+	suite.db = db
+}
+
+func (suite *DriverTestSuite) TearDownTest() {
+	suite.Nil(suite.db.Close())
+}
+
+// writeDB writes the given records into a database file
+func (suite *DriverTestSuite) writeDB(path string, records []record) {
+	f, err := os.Create(path)
+	suite.Require().Nil(err)
+	defer f.Close()
+
+	writer, err := cdb.New().GetWriter(f)
+	suite.Require().Nil(err)
+
+	for _, r := range records {
+		suite.Require().Nil(writer.Put([]byte(r.key), []byte(r.value)))
+	}
+
+	suite.Require().Nil(writer.Close())
+}
+
+// query returns all rows of the query
+func (suite *DriverTestSuite) query(db *sql.DB, statement string, args ...interface{}) []record {
+	rows, err := db.Query(statement, args...)
+	suite.Require().Nil(err)
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	suite.Require().Nil(err)
+
+	var result []record
+
+	for rows.Next() {
+		var r record
+
+		dest := make([]interface{}, len(columns))
+		for i, column := range columns {
+			if column == "key" {
+				dest[i] = &r.key
+			} else {
+				dest[i] = &r.value
+			}
+		}
+
+		suite.Require().Nil(rows.Scan(dest...))
+		result = append(result, r)
+	}
+
+	suite.Require().Nil(rows.Err())
+
+	return result
+}
+
+func (suite *DriverTestSuite) TestScan() {
+	suite.Equal(
+		[]record{{"a", "1"}, {"b", "2"}, {"a", "3"}, {"it's", "quoted"}},
+		suite.query(suite.db, "SELECT * FROM t"),
+	)
+	suite.Equal(
+		[]record{{"a", "1"}, {"b", "2"}},
+		suite.query(suite.db, "select key, value from t limit 2;"),
+	)
+	suite.Equal([]record{{"", "1"}}, suite.query(suite.db, "SELECT value FROM t LIMIT ?", 1))
+	suite.Empty(suite.query(suite.db, "SELECT key FROM t LIMIT 0"))
+}
+
+func (suite *DriverTestSuite) TestLookup() {
+	suite.Equal([]record{{"a", "1"}, {"a", "3"}}, suite.query(suite.db, "SELECT * FROM t WHERE key = ?", "a"))
+	suite.Equal([]record{{"a", "1"}}, suite.query(suite.db, "SELECT * FROM t WHERE key = $1 LIMIT $2", []byte("a"), 1))
+	suite.Equal([]record{{"", "quoted"}}, suite.query(suite.db, "SELECT value FROM t WHERE key = 'it''s'"))
+	suite.Empty(suite.query(suite.db, "SELECT * FROM t WHERE key = 'missing'"))
+
+	var value string
+	suite.Nil(suite.db.QueryRow(`SELECT "value" FROM t WHERE "key" = ?`, "b").Scan(&value))
+	suite.Equal("2", value)
+	suite.Equal(sql.ErrNoRows, suite.db.QueryRow("SELECT value FROM t WHERE key = ?", "c").Scan(&value))
+}
+
+func (suite *DriverTestSuite) TestColumnTypes() {
+	for types, expected := range map[string][2]string{
+		"":              {"BLOB", "[]uint8"},
+		"?types=bytes":  {"BLOB", "[]uint8"},
+		"?types=string": {"TEXT", "string"},
+	} {
+		db, err := sql.Open("cdb", suite.path+types)
+		suite.Require().Nil(err)
+
+		rows, err := db.Query("SELECT key FROM t LIMIT 1")
+		suite.Require().Nil(err)
+
+		columnTypes, err := rows.ColumnTypes()
+		suite.Require().Nil(err)
+		suite.Equal(expected[0], columnTypes[0].DatabaseTypeName())
+		suite.Equal(expected[1], columnTypes[0].ScanType().String())
+
+		suite.True(rows.Next())
+
+		var key interface{}
+		suite.Nil(rows.Scan(&key))
+		suite.Equal(expected[1], reflectType(key))
+
+		suite.Nil(rows.Close())
+		suite.Nil(db.Close())
+	}
+}
+
+func (suite *DriverTestSuite) TestEmptyDatabase() {
+	path := filepath.Join(suite.T().TempDir(), "empty.cdb")
+	suite.writeDB(path, nil)
+
+	db, err := sql.Open("cdb", path)
+	suite.Require().Nil(err)
+	defer db.Close()
+
+	suite.Empty(suite.query(db, "SELECT * FROM t"))
+}
+
+func (suite *DriverTestSuite) TestConnector() {
+	f, err := os.Open(suite.path)
+	suite.Require().Nil(err)
+	defer f.Close()
+
+	reader, err := cdb.New().GetReader(f)
+	suite.Require().Nil(err)
+
+	db := sql.OpenDB(NewConnector(reader, String))
+	defer db.Close()
+
+	suite.Equal([]record{{"b", "2"}}, suite.query(db, "SELECT * FROM t WHERE key = 'b'"))
+}
+
+func (suite *DriverTestSuite) TestDriverOpenClosesFile() {
+	c, err := (&Driver{}).Open(suite.path)
+	suite.Require().Nil(err)
+
+	f, ok := c.(*conn).closer.(*os.File)
+	suite.Require().True(ok, "the connection should own the file")
+
+	suite.Nil(c.Close())
+	_, err = f.Stat()
+	suite.ErrorIs(err, os.ErrClosed)
+
+	connector, err := (&Driver{}).OpenConnector(suite.path)
+	suite.Require().Nil(err)
+
+	c, err = connector.Connect(context.Background())
+	suite.Require().Nil(err)
+	suite.Nil(c.Close())
+
+	db := sql.OpenDB(connector)
+	suite.Equal([]record{{"b", "2"}}, suite.query(db, "SELECT * FROM t WHERE key = 'b'"), "the shared file should stay open")
+	suite.Nil(db.Close())
+}
+
+func (suite *DriverTestSuite) TestErrors() {
+	_, err := suite.db.Exec("INSERT INTO t VALUES ('c', '4')")
+	suite.Equal(ErrReadOnly, err)
+
+	_, err = suite.db.Exec("SELECT * FROM t")
+	suite.Equal(ErrReadOnly, err)
+
+	for _, statement := range []string{
+		"SELECT",
+		"SELECT id FROM t",
+		"SELECT * FROM t WHERE value = 'a'",
+		"SELECT * FROM t WHERE key = 'a",
+		"SELECT * FROM t LIMIT 'a'",
+		"SELECT * FROM t ORDER BY key",
+		"SHOW TABLES",
+	} {
+		_, err := suite.db.Query(statement)
+		suite.NotNil(err, statement)
+	}
+
+	_, err = suite.db.Query("SELECT * FROM t LIMIT ?", -1)
+	suite.NotNil(err)
+
+	_, err = suite.db.Query("SELECT * FROM t WHERE key = ?", 1)
+	suite.NotNil(err)
+
+	_, err = sql.Open("cdb", suite.path+"?types=int")
+	suite.NotNil(err)
+
+	db, err := sql.Open("cdb", filepath.Join(suite.T().TempDir(), "missing.cdb"))
+	suite.NotNil(err)
+	suite.Nil(db)
+}
+
+func (suite *DriverTestSuite) TestCancelledContext() {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := suite.db.QueryContext(ctx, "SELECT * FROM t")
+	suite.Equal(context.Canceled, err)
+}
+
+// reflectType returns the name of the type of the value
+func reflectType(value interface{}) string {
+	switch value.(type) {
+	case []byte:
+		return "[]uint8"
+	case string:
+		return "string"
+	}
+
+	return "unknown"
+}
+
+func TestDriverTestSuite(t *testing.T) {
+	suite.Run(t, new(DriverTestSuite))
+}
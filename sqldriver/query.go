@@ -0,0 +1,312 @@
+package sqldriver
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Columns of the table
+const (
+	columnKey   = "key"
+	columnValue = "value"
+)
+
+// ErrReadOnly is returned for statements which modify data
+var ErrReadOnly = errors.New("sqldriver: database is read-only")
+
+// operand is a literal or a placeholder of a query
+type operand struct {
+	// placeholder is the 1-based index of the argument, 0 means the literal
+	placeholder int
+	literal     string
+}
+
+// query is a parsed statement: SELECT <columns> FROM <table> [WHERE key = <operand>] [LIMIT <operand>]
+type query struct {
+	columns  []string
+	key      *operand
+	limit    *operand
+	numInput int
+}
+
+// token is a lexeme of a statement
+type token struct {
+	kind  tokenKind
+	text  string
+	quote bool
+}
+
+// tokenKind is a kind of a token
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenString
+	tokenNumber
+	tokenSymbol
+	tokenEnd
+)
+
+// parser parses a statement
+type parser struct {
+	tokens   []token
+	pos      int
+	numInput int
+}
+
+// parseQuery parses the statement
+func parseQuery(statement string) (*query, error) {
+	if fields := strings.Fields(statement); len(fields) > 0 {
+		switch strings.ToLower(fields[0]) {
+		case "insert", "update", "delete", "replace", "create", "drop", "alter", "truncate":
+			return nil, ErrReadOnly
+		}
+	}
+
+	tokens, err := tokenize(statement)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+
+	return p.parse()
+}
+
+// parse parses the whole statement
+func (p *parser) parse() (*query, error) {
+	if !p.keyword("select") {
+		return nil, p.unexpected("SELECT")
+	}
+
+	q := &query{}
+
+	for {
+		column, err := p.column()
+		if err != nil {
+			return nil, err
+		}
+
+		q.columns = append(q.columns, column...)
+
+		if !p.symbol(",") {
+			break
+		}
+	}
+
+	if !p.keyword("from") {
+		return nil, p.unexpected("FROM")
+	}
+
+	// there is a single table, its name does not matter
+	if t := p.next(); t.kind != tokenWord {
+		return nil, fmt.Errorf("sqldriver: expected table name, got %s", t)
+	}
+
+	if p.keyword("where") {
+		if column := p.next(); column.kind != tokenWord || strings.ToLower(column.text) != columnKey {
+			return nil, fmt.Errorf("sqldriver: only WHERE key = ? is supported, got %s", column)
+		}
+
+		if !p.symbol("=") {
+			return nil, p.unexpected("=")
+		}
+
+		key, err := p.operand(tokenString)
+		if err != nil {
+			return nil, err
+		}
+
+		q.key = key
+	}
+
+	if p.keyword("limit") {
+		limit, err := p.operand(tokenNumber)
+		if err != nil {
+			return nil, err
+		}
+
+		q.limit = limit
+	}
+
+	p.symbol(";")
+
+	if t := p.peek(); t.kind != tokenEnd {
+		return nil, fmt.Errorf("sqldriver: unexpected %s", t)
+	}
+
+	q.numInput = p.numInput
+
+	return q, nil
+}
+
+// column parses a column name or *
+func (p *parser) column() ([]string, error) {
+	if p.symbol("*") {
+		return []string{columnKey, columnValue}, nil
+	}
+
+	t := p.next()
+	if t.kind == tokenWord {
+		switch name := strings.ToLower(t.text); name {
+		case columnKey, columnValue:
+			return []string{name}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("sqldriver: unknown column %s, the table has columns key and value", t)
+}
+
+// operand parses a placeholder or a literal of the given kind
+func (p *parser) operand(kind tokenKind) (*operand, error) {
+	t := p.next()
+
+	switch {
+	case t.kind == tokenSymbol && t.text == "?":
+		p.numInput++
+		return &operand{placeholder: p.numInput}, nil
+	case t.kind == tokenSymbol && t.text[0] == '$':
+		n, err := strconv.Atoi(t.text[1:])
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("sqldriver: invalid placeholder %s", t)
+		}
+
+		p.numInput = max(p.numInput, n)
+
+		return &operand{placeholder: n}, nil
+	case t.kind == kind:
+		return &operand{literal: t.text}, nil
+	}
+
+	return nil, fmt.Errorf("sqldriver: unexpected %s", t)
+}
+
+// keyword consumes the next token if it is the given keyword
+func (p *parser) keyword(word string) bool {
+	if t := p.peek(); t.kind == tokenWord && !t.quote && strings.EqualFold(t.text, word) {
+		p.pos++
+		return true
+	}
+
+	return false
+}
+
+// symbol consumes the next token if it is the given symbol
+func (p *parser) symbol(symbol string) bool {
+	if t := p.peek(); t.kind == tokenSymbol && t.text == symbol {
+		p.pos++
+		return true
+	}
+
+	return false
+}
+
+// unexpected returns an error about the next token
+func (p *parser) unexpected(expected string) error {
+	return fmt.Errorf("sqldriver: expected %s, got %s", expected, p.peek())
+}
+
+// peek returns the next token without consuming it
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+// next consumes the next token
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEnd {
+		p.pos++
+	}
+
+	return t
+}
+
+// String describes the token in error messages
+func (t token) String() string {
+	if t.kind == tokenEnd {
+		return "end of statement"
+	}
+
+	return strconv.Quote(t.text)
+}
+
+// tokenize splits the statement into tokens, the last one is tokenEnd
+func tokenize(statement string) ([]token, error) {
+	var tokens []token
+
+	runes := []rune(statement)
+
+	for i := 0; i < len(runes); {
+		c := runes[i]
+
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '\'':
+			// a quote inside a string literal is doubled
+			var text strings.Builder
+
+			for i++; ; i++ {
+				if i == len(runes) {
+					return nil, errors.New("sqldriver: unterminated string literal")
+				}
+
+				if runes[i] == '\'' {
+					if i+1 < len(runes) && runes[i+1] == '\'' {
+						i++
+					} else {
+						i++
+						break
+					}
+				}
+
+				text.WriteRune(runes[i])
+			}
+
+			tokens = append(tokens, token{kind: tokenString, text: text.String()})
+		case c == '"' || c == '`':
+			end := i + 1
+			for end < len(runes) && runes[end] != c {
+				end++
+			}
+
+			if end == len(runes) {
+				return nil, errors.New("sqldriver: unterminated quoted identifier")
+			}
+
+			tokens = append(tokens, token{kind: tokenWord, text: string(runes[i+1 : end]), quote: true})
+			i = end + 1
+		case c == '$' || unicode.IsDigit(c):
+			end := i + 1
+			for end < len(runes) && unicode.IsDigit(runes[end]) {
+				end++
+			}
+
+			kind := tokenNumber
+			if c == '$' {
+				kind = tokenSymbol
+			}
+
+			tokens = append(tokens, token{kind: kind, text: string(runes[i:end])})
+			i = end
+		case c == '_' || unicode.IsLetter(c):
+			end := i + 1
+			for end < len(runes) && (runes[end] == '_' || runes[end] == '.' || unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end])) {
+				end++
+			}
+
+			tokens = append(tokens, token{kind: tokenWord, text: string(runes[i:end])})
+			i = end
+		case strings.ContainsRune("*,=?;", c):
+			tokens = append(tokens, token{kind: tokenSymbol, text: string(c)})
+			i++
+		default:
+			return nil, fmt.Errorf("sqldriver: unexpected character %q", c)
+		}
+	}
+
+	return append(tokens, token{kind: tokenEnd}), nil
+}
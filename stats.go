@@ -0,0 +1,59 @@
+package cdb
+
+import "time"
+
+// WriterStats describes the progress of building a database.
+type WriterStats struct {
+	// Records is the number of records put so far
+	Records int
+	// Bytes is the size of records put so far (headers, keys and values)
+	Bytes int64
+	// Offset is the current position in the file, it can not exceed Limit
+	Offset int64
+	// Limit is the max addressable size of a database
+	Limit int64
+}
+
+// TableStats describes a hash table of a committed database.
+type TableStats struct {
+	// Records is the number of records in the table
+	Records int
+	// Slots is the number of slots in the table
+	Slots int
+	// MaxProbe is the length of the longest probe chain, i.e. the max number of slots
+	// Reader checks to find a record of the table
+	MaxProbe int
+}
+
+// BuildSummary describes a committed database.
+type BuildSummary struct {
+	WriterStats
+	// Size is the size of the whole database file
+	Size int64
+	// Tables describes each of 256 hash tables
+	Tables [tableNum]TableStats
+	// MaxProbe is the length of the longest probe chain of all tables
+	MaxProbe int
+}
+
+// ProgressFunc is a callback which receives the progress of building a database.
+type ProgressFunc func(stats WriterStats)
+
+// progress calls the progress callback if the interval has passed since the last call
+type progress struct {
+	fn       ProgressFunc
+	interval time.Duration
+	last     time.Time
+}
+
+// report calls the callback with the given stats if it is time to
+func (p *progress) report(stats func() WriterStats) {
+	if p.fn == nil {
+		return
+	}
+
+	if now := time.Now(); now.Sub(p.last) >= p.interval {
+		p.last = now
+		p.fn(stats())
+	}
+}
@@ -0,0 +1,117 @@
+package cdb
+
+import "os"
+
+func (suite *CDBTestSuite) TestWriterStats() {
+	var reports []WriterStats
+
+	suite.cdbHandle.SetProgress(0, func(stats WriterStats) {
+		reports = append(reports, stats)
+	})
+
+	writer := suite.getCDBWriter()
+	bytes := int64(0)
+
+	for i, rec := range suite.testRecords {
+		suite.Require().Nil(writer.Put(rec.key, rec.val))
+		bytes += int64(8 + len(rec.key) + len(rec.val))
+
+		stats := writer.Stats()
+		suite.Equal(i+1, stats.Records)
+		suite.Equal(bytes, stats.Bytes)
+		suite.Equal(tablesRefsSize+bytes, stats.Offset)
+		suite.Equal(int64(maxUint), stats.Limit)
+	}
+
+	suite.Len(reports, len(suite.testRecords))
+
+	summary, err := writer.CloseWithSummary()
+	suite.Require().Nil(err)
+	suite.assertSummary(summary)
+}
+
+func (suite *CDBTestSuite) TestParallelWriterStats() {
+	reports := 0
+	suite.cdbHandle.SetProgress(0, func(stats WriterStats) {
+		reports++
+	})
+
+	writer, err := suite.cdbHandle.GetParallelWriter(suite.cdbFile, 2)
+	suite.Require().Nil(err)
+
+	for _, rec := range suite.testRecords {
+		suite.Require().Nil(writer.Put(rec.key, rec.val))
+	}
+
+	suite.Equal(len(suite.testRecords), writer.Stats().Records)
+	suite.Equal(len(suite.testRecords), reports)
+
+	summary, err := writer.CloseWithSummary()
+	suite.Require().Nil(err)
+	suite.assertSummary(summary)
+}
+
+func (suite *CDBTestSuite) assertSummary(summary BuildSummary) {
+	records, slots := 0, 0
+
+	for _, table := range summary.Tables {
+		records += table.Records
+		slots += table.Slots
+
+		suite.True(table.MaxProbe <= summary.MaxProbe)
+	}
+
+	suite.Equal(len(suite.testRecords), summary.Records)
+	suite.Equal(len(suite.testRecords), records)
+	suite.Equal(2*len(suite.testRecords), slots)
+	suite.True(summary.MaxProbe >= 1)
+
+	info, err := os.Stat(suite.cdbFile.Name())
+	suite.Require().Nil(err)
+	suite.Equal(info.Size(), summary.Size)
+}
+
+func (suite *CDBTestSuite) TestEstimatedSize() {
+	writers := map[string]func() Writer{
+		"writer": suite.getCDBWriter,
+		"parallel": func() Writer {
+			writer, err := suite.cdbHandle.GetParallelWriter(suite.cdbFile, 2)
+			suite.Require().Nil(err)
+			return writer
+		},
+	}
+
+	for name, getWriter := range writers {
+		suite.resetCDBFile()
+
+		writer := getWriter()
+		suite.Equal(int64(tablesRefsSize), writer.EstimatedSize(), name)
+
+		for _, rec := range suite.testRecords {
+			suite.Require().Nil(writer.Put(rec.key, rec.val))
+		}
+
+		estimated := writer.EstimatedSize()
+		suite.Require().Nil(writer.Close())
+
+		info, err := os.Stat(suite.cdbFile.Name())
+		suite.Require().Nil(err)
+		suite.Equal(info.Size(), estimated, name)
+	}
+}
+
+func (suite *CDBTestSuite) TestPutFailsBeforeOverflow() {
+	writer := suite.getCDBWriter()
+	impl := writer.(*writerImpl)
+
+	// pretend that the database is almost full
+	impl.current = maxUint - 1000
+
+	err := writer.Put(make([]byte, 500), make([]byte, 500))
+	suite.Equal(ErrOutOfMemory, err, "the record fits, but its hash table slots do not")
+	suite.Equal(int64(maxUint-1000), writer.EstimatedSize())
+
+	suite.Nil(writer.Put([]byte("key"), []byte("value")), "the writer should be usable after ErrOutOfMemory")
+	suite.Equal(int64(maxUint-1000+8+3+5+2*slotSize), writer.EstimatedSize())
+	suite.Equal(1, writer.Stats().Records)
+}
@@ -0,0 +1,203 @@
+package cdb
+
+import (
+	"iter"
+	"sync"
+)
+
+// TypedWriter is a Writer of keys of type K and values of type V, which are encoded by the given codecs.
+type TypedWriter[K, V any] struct {
+	writer Writer
+	keys   Codec[K]
+	values Codec[V]
+}
+
+// codecRecorder is implemented by writers which record names of codecs in the database
+type codecRecorder interface {
+	setCodecs(key, value string)
+}
+
+// NewTypedWriter returns a new instance of TypedWriter over the given writer.
+// Names of codecs which implement NamedCodec are recorded in the database, see Reader.Codecs.
+func NewTypedWriter[K, V any](writer Writer, keys Codec[K], values Codec[V]) *TypedWriter[K, V] {
+	if recorder, ok := writer.(codecRecorder); ok {
+		recorder.setCodecs(codecName(keys), codecName(values))
+	}
+
+	return &TypedWriter[K, V]{
+		writer: writer,
+		keys:   keys,
+		values: values,
+	}
+}
+
+// Put encodes and saves a new associated pair <key, value> into databases. Returns an error on failure.
+func (w *TypedWriter[K, V]) Put(key K, value V) error {
+	k, err := w.keys.Encode(key)
+	if err != nil {
+		return err
+	}
+
+	v, err := w.values.Encode(value)
+	if err != nil {
+		return err
+	}
+
+	return w.writer.Put(k, v)
+}
+
+// Close commits database, makes it possible for reading.
+func (w *TypedWriter[K, V]) Close() error {
+	return w.writer.Close()
+}
+
+// Writer returns the underlying Writer
+func (w *TypedWriter[K, V]) Writer() Writer {
+	return w.writer
+}
+
+// TypedReader is a Reader of keys of type K and values of type V, which are decoded by the given codecs.
+// All methods are thread safe.
+type TypedReader[K, V any] struct {
+	reader Reader
+	keys   Codec[K]
+	values Codec[V]
+	// err is the first codec error which stopped a sequence, see Err
+	mu  sync.Mutex
+	err error
+}
+
+// NewTypedReader returns a new instance of TypedReader over the given reader
+func NewTypedReader[K, V any](reader Reader, keys Codec[K], values Codec[V]) *TypedReader[K, V] {
+	return &TypedReader[K, V]{
+		reader: reader,
+		keys:   keys,
+		values: values,
+	}
+}
+
+// Get returns the first value associated with the given key, ErrEntryNotFound if there is no such key
+func (r *TypedReader[K, V]) Get(key K) (V, error) {
+	var value V
+
+	k, err := r.keys.Encode(key)
+	if err != nil {
+		return value, err
+	}
+
+	v, err := r.reader.Get(k)
+	if err != nil {
+		return value, err
+	}
+
+	return r.values.Decode(v)
+}
+
+// Has returns true if the given key exists, otherwise returns false.
+func (r *TypedReader[K, V]) Has(key K) (bool, error) {
+	k, err := r.keys.Encode(key)
+	if err != nil {
+		return false, err
+	}
+
+	return r.reader.Has(k)
+}
+
+// All returns a sequence of all decoded records in file order. A read or decode error stops the loop,
+// Err returns it.
+func (r *TypedReader[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(key K, value V) bool) {
+		for k, v := range r.reader.All() {
+			key, value, err := r.decode(k, v)
+			if err != nil {
+				r.setErr(err)
+				return
+			}
+
+			if !yield(key, value) {
+				return
+			}
+		}
+	}
+}
+
+// Keys is like All, but yields only keys.
+func (r *TypedReader[K, V]) Keys() iter.Seq[K] {
+	return func(yield func(key K) bool) {
+		for k := range r.reader.Keys() {
+			key, err := r.keys.Decode(k)
+			if err != nil {
+				r.setErr(err)
+				return
+			}
+
+			if !yield(key) {
+				return
+			}
+		}
+	}
+}
+
+// ValuesFor returns a sequence of all decoded values associated with the given key in the order of Put calls.
+// A read, encode or decode error stops the loop, Err returns it.
+func (r *TypedReader[K, V]) ValuesFor(key K) iter.Seq[V] {
+	return func(yield func(value V) bool) {
+		k, err := r.keys.Encode(key)
+		if err != nil {
+			r.setErr(err)
+			return
+		}
+
+		for v := range r.reader.ValuesFor(k) {
+			value, err := r.values.Decode(v)
+			if err != nil {
+				r.setErr(err)
+				return
+			}
+
+			if !yield(value) {
+				return
+			}
+		}
+	}
+}
+
+// Err returns the first error which stopped a sequence of All, Keys or ValuesFor: an error of a codec
+// or a read error of the underlying Reader, nil if there was none.
+func (r *TypedReader[K, V]) Err() error {
+	r.mu.Lock()
+	err := r.err
+	r.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	return r.reader.Err()
+}
+
+// setErr keeps the given error if there is no error yet
+func (r *TypedReader[K, V]) setErr(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+// decode decodes the given key and value
+func (r *TypedReader[K, V]) decode(k, v []byte) (key K, value V, err error) {
+	if key, err = r.keys.Decode(k); err != nil {
+		return key, value, err
+	}
+
+	value, err = r.values.Decode(v)
+
+	return key, value, err
+}
+
+// Reader returns the underlying Reader
+func (r *TypedReader[K, V]) Reader() Reader {
+	return r.reader
+}
@@ -0,0 +1,115 @@
+package cdb
+
+import "io"
+
+func (suite *CDBTestSuite) fillTypedCDB() map[string]uint64 {
+	data := map[string]uint64{"one": 1, "two": 2, "three": 3, "big": 1 << 40}
+
+	writer := NewTypedWriter[string, uint64](suite.getCDBWriter(), StringCodec{}, UvarintCodec[uint64]{})
+
+	for key, value := range data {
+		suite.Require().Nil(writer.Put(key, value))
+	}
+
+	suite.Require().Nil(writer.Put("one", 11))
+	suite.Require().Nil(writer.Close())
+
+	return data
+}
+
+func (suite *CDBTestSuite) TestTypedReaderGet() {
+	data := suite.fillTypedCDB()
+	reader := NewTypedReader[string, uint64](suite.getCDBReader(), StringCodec{}, UvarintCodec[uint64]{})
+
+	for key, expected := range data {
+		value, err := reader.Get(key)
+		suite.Nil(err)
+		suite.Equal(expected, value)
+	}
+
+	_, err := reader.Get("missing")
+	suite.Equal(ErrEntryNotFound, err)
+
+	ok, err := reader.Has("two")
+	suite.Nil(err)
+	suite.True(ok)
+}
+
+func (suite *CDBTestSuite) TestTypedReaderIteration() {
+	data := suite.fillTypedCDB()
+	reader := NewTypedReader[string, uint64](suite.getCDBReader(), StringCodec{}, UvarintCodec[uint64]{})
+
+	all := make(map[string]uint64)
+
+	for key, value := range reader.All() {
+		if _, ok := all[key]; !ok {
+			all[key] = value
+		}
+	}
+
+	suite.Equal(data, all)
+
+	var values []uint64
+
+	for value := range reader.ValuesFor("one") {
+		values = append(values, value)
+	}
+
+	suite.Equal([]uint64{1, 11}, values)
+
+	keys := 0
+	for range reader.Keys() {
+		keys++
+	}
+
+	suite.Equal(len(data)+1, keys)
+	suite.Nil(reader.Err())
+}
+
+func (suite *CDBTestSuite) TestTypedReaderReportsDecodeErrors() {
+	writer := suite.getCDBWriter()
+	suite.Require().Nil(writer.Put([]byte("key"), []byte{0x80}))
+	suite.Require().Nil(writer.Close())
+
+	reader := NewTypedReader[string, uint64](suite.getCDBReader(), StringCodec{}, UvarintCodec[uint64]{})
+
+	_, err := reader.Get("key")
+	suite.Equal(ErrInvalidEncoding, err)
+
+	for range reader.All() {
+		suite.Fail("a record which can not be decoded should not be yielded")
+	}
+
+	suite.Equal(ErrInvalidEncoding, reader.Err())
+	suite.Nil(reader.Reader().Err())
+}
+
+func (suite *CDBTestSuite) TestTypedWriterRecordsCodecs() {
+	suite.fillTypedCDB()
+
+	key, value := suite.getCDBReader().Codecs()
+	suite.Equal("string", key)
+	suite.Equal("uvarint", value)
+
+	_, err := suite.cdbFile.Seek(0, io.SeekStart)
+	suite.Require().Nil(err)
+
+	writer, err := suite.cdbHandle.GetParallelWriter(suite.cdbFile, 2)
+	suite.Require().Nil(err)
+
+	typed := NewTypedWriter[[]byte, int64](writer, BytesCodec{}, FixedCodec[int64]{})
+	suite.Require().Nil(typed.Put([]byte("key"), -1))
+	suite.Require().Nil(typed.Close())
+
+	key, value = suite.getCDBReader().Codecs()
+	suite.Equal("", key)
+	suite.Equal("fixed:int64", value)
+
+	_, err = suite.cdbFile.Seek(0, io.SeekStart)
+	suite.Require().Nil(err)
+	suite.fillTestCDB()
+
+	key, value = suite.getCDBReader().Codecs()
+	suite.Equal("", key)
+	suite.Equal("", value)
+}
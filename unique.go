@@ -0,0 +1,128 @@
+package cdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// DuplicateMode tells Writer what to do with a key that has already been put.
+type DuplicateMode int
+
+const (
+	// AllowDuplicates stores all records of a key, Reader.Get returns the first one
+	AllowDuplicates DuplicateMode = iota
+	// RejectDuplicates makes Put return ErrDuplicateKey for a key that has already been put
+	RejectDuplicates
+	// ReplaceDuplicates makes the last record of a key win: the previous record stays in the file,
+	// but it is not referenced by the hash tables anymore
+	ReplaceDuplicates
+)
+
+var (
+	// ErrDuplicateKey tells that a key has already been put into a database in RejectDuplicates mode
+	ErrDuplicateKey = errors.New("duplicate cdb key")
+	// ErrWriterNotReadable tells that a unique keys mode requires io.ReaderAt to compare keys of written records,
+	// signing requires it to compute the digest of the written database
+	ErrWriterNotReadable = errors.New("unique keys mode and signing require the writer to implement io.ReaderAt")
+)
+
+// slotRef points to a slot of a hash table which is being built
+type slotRef struct {
+	table int
+	// index is the position of the slot in w.tables[table], -1 if the slot was spilled
+	index int
+	// offset is the position of the slot in the spill file
+	offset int64
+}
+
+// indexSlot records the number of the slot which is being added to the hash table of the key,
+// so later records of the key are found by findKey. Slots are numbered in the order they were added:
+// spilled ones first, then ones kept in w.tables.
+func (w *writerImpl) indexSlot(h uint32) {
+	table := int(h % tableNum)
+	n := uint32(len(w.tables[table]))
+
+	if w.spill != nil {
+		n += w.spill.counts[table]
+	}
+
+	if w.keyIndex == nil {
+		w.keyIndex = make(map[uint32][]uint32)
+	}
+
+	w.keyIndex[h] = append(w.keyIndex[h], n)
+}
+
+// findKey looks for a record with the given key among written ones. Only records of slots with the same
+// hash (see indexSlot) are compared, their keys are read back from the file.
+func (w *writerImpl) findKey(key []byte, h uint32) (slotRef, bool, error) {
+	for _, n := range w.keyIndex[h] {
+		ref, position, err := w.slotAt(int(h%tableNum), n)
+		if err != nil {
+			return ref, false, err
+		}
+
+		if found, err := w.hasKey(position, key); err != nil || found {
+			return ref, found, err
+		}
+	}
+
+	return slotRef{}, false, nil
+}
+
+// slotAt returns the reference to the n-th slot of the given table and the position of its record
+func (w *writerImpl) slotAt(table int, n uint32) (slotRef, uint32, error) {
+	var spilled uint32
+	if w.spill != nil {
+		spilled = w.spill.counts[table]
+	}
+
+	if n >= spilled {
+		ref := slotRef{table: table, index: int(n - spilled)}
+		return ref, w.tables[table][ref.index].position, nil
+	}
+
+	ref := slotRef{table: table, index: -1, offset: w.spill.slotOffset(table, n)}
+	position, err := w.spill.readUint32(ref.offset + 4)
+
+	return ref, position, err
+}
+
+// hasKey returns true if the record at the given position has the given key. The write buffer
+// is flushed only if the record has not been written to the file yet.
+func (w *writerImpl) hasKey(position uint32, key []byte) (bool, error) {
+	buf := make([]byte, 8+len(key))
+
+	if int64(position)+int64(len(buf)) > w.current-int64(w.buffer.Buffered()) {
+		if err := w.buffer.Flush(); err != nil {
+			return false, err
+		}
+	}
+
+	n, err := w.writer.(io.ReaderAt).ReadAt(buf, int64(position))
+	if n >= 8 && binary.LittleEndian.Uint32(buf) != uint32(len(key)) {
+		return false, nil
+	}
+
+	if n < len(buf) {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+
+		return false, err
+	}
+
+	return bytes.Equal(buf[8:], key), nil
+}
+
+// replaceSlot makes the given slot point to the record at the given position
+func (w *writerImpl) replaceSlot(ref slotRef, position uint32) error {
+	if ref.index >= 0 {
+		w.tables[ref.table][ref.index].position = position
+		return nil
+	}
+
+	return w.spill.writeUint32(position, ref.offset+4)
+}
@@ -0,0 +1,133 @@
+package cdb
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strconv"
+)
+
+func (suite *CDBTestSuite) putWithDuplicates(mode DuplicateMode) []error {
+	suite.cdbHandle.SetHash(newCollidingHash)
+	suite.cdbHandle.SetDuplicates(mode)
+
+	writer := suite.getCDBWriter()
+	errs := make([]error, 0)
+
+	for round := 0; round < 2; round++ {
+		for i := 0; i < 2000; i++ {
+			stri := strconv.Itoa(i)
+			errs = append(errs, writer.Put([]byte("key"+stri), []byte("value"+stri+"_"+strconv.Itoa(round))))
+		}
+	}
+
+	suite.Require().Nil(writer.Close())
+
+	return errs
+}
+
+func (suite *CDBTestSuite) TestRejectDuplicates() {
+	errs := suite.putWithDuplicates(RejectDuplicates)
+
+	for i, err := range errs {
+		if i < 2000 {
+			suite.Nil(err)
+		} else {
+			suite.Equal(ErrDuplicateKey, err)
+		}
+	}
+
+	reader := suite.getCDBReader()
+	suite.Equal(2000, reader.Size())
+
+	for i := 0; i < 2000; i++ {
+		value, err := reader.Get([]byte("key" + strconv.Itoa(i)))
+		suite.Nil(err)
+		suite.Equal("value"+strconv.Itoa(i)+"_0", string(value))
+	}
+}
+
+func (suite *CDBTestSuite) TestReplaceDuplicates() {
+	for _, limit := range []int{0, 1000} {
+		suite.cdbHandle.SetMemoryLimit(limit)
+
+		for _, err := range suite.putWithDuplicates(ReplaceDuplicates) {
+			suite.Nil(err)
+		}
+
+		reader := suite.getCDBReader()
+		suite.Equal(2000, reader.Size())
+
+		for i := 0; i < 2000; i++ {
+			value, err := reader.Get([]byte("key" + strconv.Itoa(i)))
+			suite.Nil(err)
+			suite.Equal("value"+strconv.Itoa(i)+"_1", string(value))
+		}
+	}
+}
+
+// countingFile counts ReadAt calls of a writer
+type countingFile struct {
+	*os.File
+	reads int
+}
+
+func (f *countingFile) ReadAt(p []byte, off int64) (int, error) {
+	f.reads++
+	return f.File.ReadAt(p, off)
+}
+
+func (suite *CDBTestSuite) TestUniqueKeysDoNotReadBack() {
+	suite.cdbHandle.SetDuplicates(RejectDuplicates)
+	suite.cdbHandle.SetMemoryLimit(1000)
+
+	file := &countingFile{File: suite.cdbFile}
+	writer, err := suite.cdbHandle.GetWriter(file)
+	suite.Require().Nil(err)
+
+	for i := 0; i < 2000; i++ {
+		suite.Require().Nil(writer.Put([]byte("key"+strconv.Itoa(i)), []byte("value")))
+	}
+
+	// only records with equal hashes are read back
+	suite.Zero(file.reads)
+	suite.Equal(ErrDuplicateKey, writer.Put([]byte("key1"), []byte("value")))
+	suite.Equal(1, file.reads)
+	suite.Require().Nil(writer.Close())
+}
+
+func (suite *CDBTestSuite) TestDuplicatesRequireReaderAt() {
+	suite.cdbHandle.SetDuplicates(RejectDuplicates)
+
+	_, err := suite.cdbHandle.GetWriter(struct{ io.WriteSeeker }{suite.cdbFile})
+	suite.Equal(ErrWriterNotReadable, err)
+}
+
+func (suite *CDBTestSuite) TestParallelWriterDuplicatesFollowPutOrder() {
+	suite.cdbHandle.SetDuplicates(ReplaceDuplicates)
+
+	writer, err := suite.cdbHandle.GetParallelWriter(suite.cdbFile, 2)
+	suite.Require().Nil(err)
+	suite.Require().Nil(writer.Put([]byte("key"), []byte("b")))
+	suite.Require().Nil(writer.Put([]byte("key"), []byte("a")))
+	suite.Require().Nil(writer.Close())
+
+	value, err := suite.getCDBReader().Get([]byte("key"))
+	suite.Nil(err)
+	suite.Equal("a", string(value))
+}
+
+func (suite *CDBTestSuite) TestParallelWriterRejectsDuplicatesOnClose() {
+	suite.cdbHandle.SetDuplicates(RejectDuplicates)
+
+	writer, err := suite.cdbHandle.GetParallelWriter(suite.cdbFile, 2)
+	suite.Require().Nil(err)
+	suite.Require().Nil(writer.Put([]byte("key"), []byte("b")))
+	suite.Require().Nil(writer.Put([]byte("other"), []byte("c")))
+	suite.Require().Nil(writer.Put([]byte("key"), []byte("a")))
+
+	err = writer.Close()
+	suite.True(errors.Is(err, ErrDuplicateKey), "Close should fail on a duplicate key, got %v", err)
+	suite.Contains(err.Error(), `"key"`)
+	suite.Equal(err, writer.Close())
+}
@@ -0,0 +1,155 @@
+package cdb
+
+import (
+	"container/list"
+	"hash/fnv"
+	"sync"
+)
+
+const (
+	// Default number of ValueCache shards
+	defaultValueCacheShards = 16
+	// Approximate memory overhead of one ValueCache entry
+	valueCacheEntryOverhead = 64
+)
+
+// ValueCache keeps recently used values in memory in front of Reader.Get, so hot keys are not read
+// and copied from the underlying storage again and again. Misses are cached as well, so repeated
+// Get/Has of absent keys do not probe the hash tables.
+//
+// The cache is bounded by the total size of the cached keys and values, it is split into shards
+// (each with its own LRU list and lock) to reduce contention. A ValueCache can be shared between several readers.
+type ValueCache struct {
+	shards []*valueCacheShard
+}
+
+// valueCacheShard is an independent LRU part of ValueCache
+type valueCacheShard struct {
+	mu     sync.Mutex
+	budget int
+	used   int
+	items  map[valueCacheKey]*list.Element
+	order  *list.List
+	stats  CacheStats
+}
+
+// valueCacheKey identifies a cached value
+type valueCacheKey struct {
+	owner uint64
+	key   string
+}
+
+// valueCacheEntry is an element of valueCacheShard.order
+type valueCacheEntry struct {
+	key   valueCacheKey
+	value []byte
+	found bool
+}
+
+// NewValueCache returns a new instance of ValueCache which keeps up to size bytes of keys and values
+// split into the given number of shards. If shards is not positive, 16 shards are used.
+func NewValueCache(size, shards int) *ValueCache {
+	if shards <= 0 {
+		shards = defaultValueCacheShards
+	}
+
+	cache := &ValueCache{
+		shards: make([]*valueCacheShard, shards),
+	}
+
+	for i := range cache.shards {
+		cache.shards[i] = &valueCacheShard{
+			budget: size / shards,
+			items:  make(map[valueCacheKey]*list.Element),
+			order:  list.New(),
+		}
+	}
+
+	return cache
+}
+
+// Stats returns hit/miss counters of the cache
+func (c *ValueCache) Stats() CacheStats {
+	var stats CacheStats
+
+	for _, shard := range c.shards {
+		shard.mu.Lock()
+		stats.Hits += shard.stats.Hits
+		stats.Misses += shard.stats.Misses
+		shard.mu.Unlock()
+	}
+
+	return stats
+}
+
+// get returns a copy of the cached value and true if the key is cached.
+// found is false for cached misses.
+func (c *ValueCache) get(owner uint64, key []byte) (value []byte, found, ok bool) {
+	shard := c.shard(key)
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	elem, ok := shard.items[valueCacheKey{owner, string(key)}]
+	if !ok {
+		shard.stats.Misses++
+		return nil, false, false
+	}
+
+	shard.stats.Hits++
+	shard.order.MoveToFront(elem)
+	entry := elem.Value.(*valueCacheEntry)
+
+	if !entry.found {
+		return nil, false, true
+	}
+
+	return append([]byte(nil), entry.value...), true, true
+}
+
+// put caches the given value, found is false for misses
+func (c *ValueCache) put(owner uint64, key, value []byte, found bool) {
+	shard := c.shard(key)
+	cost := len(key) + len(value) + valueCacheEntryOverhead
+
+	if cost > shard.budget {
+		return
+	}
+
+	entry := &valueCacheEntry{
+		key:   valueCacheKey{owner, string(key)},
+		value: append([]byte(nil), value...),
+		found: found,
+	}
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if elem, ok := shard.items[entry.key]; ok {
+		shard.remove(elem)
+	}
+
+	shard.items[entry.key] = shard.order.PushFront(entry)
+	shard.used += cost
+
+	for shard.used > shard.budget {
+		shard.remove(shard.order.Back())
+	}
+}
+
+// shard returns the shard of the given key
+func (c *ValueCache) shard(key []byte) *valueCacheShard {
+	h := fnv.New32a()
+	h.Write(key)
+
+	return c.shards[h.Sum32()%uint32(len(c.shards))]
+}
+
+// remove drops the given element from the shard
+func (s *valueCacheShard) remove(elem *list.Element) {
+	entry := elem.Value.(*valueCacheEntry)
+
+	s.order.Remove(elem)
+	delete(s.items, entry.key)
+	s.used -= len(entry.key.key) + len(entry.value) + valueCacheEntryOverhead
+}
@@ -0,0 +1,85 @@
+package cdb
+
+import (
+	"bytes"
+	"testing"
+)
+
+func (suite *CDBTestSuite) TestValueCache() {
+	cache := NewValueCache(1<<20, 4)
+	suite.cdbHandle.SetValueCache(cache)
+	suite.fillTestCDB()
+
+	backend := &countingReaderAt{ReaderAt: suite.cdbFile}
+	reader, err := suite.cdbHandle.GetReader(backend)
+	suite.Require().Nil(err)
+
+	for _, rec := range suite.testRecords {
+		value, err := reader.Get(rec.key)
+		suite.Nil(err)
+		suite.Equal(rec.val, value)
+
+		value[0] = 0
+	}
+
+	_, err = reader.Get([]byte("missing"))
+	suite.Equal(ErrEntryNotFound, err)
+
+	calls := backend.calls
+
+	for _, rec := range suite.testRecords {
+		value, err := reader.Get(rec.key)
+		suite.Nil(err)
+		suite.Equal(rec.val, value, "cached value must not be affected by changes of a returned one")
+
+		exists, err := reader.Has(rec.key)
+		suite.Nil(err)
+		suite.True(exists)
+	}
+
+	value, err := reader.Get([]byte("missing"))
+	suite.Equal(ErrEntryNotFound, err)
+	suite.Nil(value)
+
+	exists, err := reader.Has([]byte("missing"))
+	suite.Nil(err)
+	suite.False(exists)
+
+	suite.Equal(calls, backend.calls, "cached keys should not be read again")
+	suite.Equal(uint64(len(suite.testRecords)*2+2), cache.Stats().Hits)
+}
+
+func (suite *CDBTestSuite) TestValueCacheConcurrentGet() {
+	suite.cdbHandle.SetValueCache(NewValueCache(512, 2))
+	suite.TestConcurrentGet()
+}
+
+func TestValueCacheBudget(t *testing.T) {
+	cache := NewValueCache(3*(valueCacheEntryOverhead+100), 1)
+
+	for i := byte(0); i < 4; i++ {
+		cache.put(1, []byte{i}, bytes.Repeat([]byte{i}, 99), true)
+	}
+
+	if _, _, ok := cache.get(1, []byte{0}); ok {
+		t.Errorf("the least recently used value should be evicted")
+	}
+
+	for i := byte(1); i < 4; i++ {
+		value, found, ok := cache.get(1, []byte{i})
+
+		if !ok || !found || !bytes.Equal(value, bytes.Repeat([]byte{i}, 99)) {
+			t.Errorf("value %d should be cached", i)
+		}
+	}
+
+	if _, _, ok := cache.get(2, []byte{1}); ok {
+		t.Errorf("values of different readers should not be mixed")
+	}
+
+	cache.put(1, []byte{5}, make([]byte, 1000), true)
+
+	if _, _, ok := cache.get(1, []byte{5}); ok {
+		t.Errorf("values larger than the budget should not be cached")
+	}
+}
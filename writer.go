@@ -2,6 +2,7 @@ package cdb
 
 import (
 	"bufio"
+	"crypto/ed25519"
 	"encoding/binary"
 	"io"
 )
@@ -21,6 +22,45 @@ type writerImpl struct {
 	buffer         *bufio.Writer
 	hasher         Hasher
 	begin, current int64
+	// filterBitsPerKey is the size of the filter of keys, 0 means there is no filter
+	filterBitsPerKey int
+	keyHashes        []uint64
+	// fingerprints are second hashes of keys, they are stored only if withFingerprints is set.
+	// Over the memory limit the first spilledFingerprints bytes of the section are moved to the temporary file.
+	withFingerprints    bool
+	fingerprints        [tableNum][]uint32
+	fingerprintData     []byte
+	fingerprintOffset   int64
+	spilledFingerprints int64
+	// tail is the end of the written hash tables, the trailer checksum covers it
+	tail []byte
+	// workers is the number of goroutines building hash tables on Close
+	workers int
+	// memoryLimit is the max size of slot lists, key hashes and fingerprints kept in memory, 0 means unlimited
+	memoryLimit int
+	inMemory    int
+	spill       *slotSpill
+	tempDir     string
+	// err is set when the writer can not be used anymore: after a failure or Close
+	err error
+	// keyCodec, valueCodec are names of codecs recorded by TypedWriter
+	keyCodec, valueCodec string
+	// index sorts keys of records for the index section, nil if there is no index
+	index *recordSorter
+	// encryption encrypts records, nil if the database is not encrypted
+	encryption *encryption
+	// signingKey signs the database on Close, nil if the database is not signed
+	signingKey ed25519.PrivateKey
+	// duplicates tells what to do with keys that have already been put, keyIndex maps hashes of put keys
+	// to numbers of their slots in unique keys modes
+	duplicates DuplicateMode
+	keyIndex   map[uint32][]uint32
+	// records, bytes describe put records, tableSize is the size of hash tables they need
+	records   int
+	bytes     int64
+	tableSize int64
+	progress  progress
+	summary   BuildSummary
 }
 
 // newWriter returns pointer to new instance of writerImpl
@@ -42,83 +82,311 @@ func newWriter(writer io.WriteSeeker, hasher Hasher) (*writerImpl, error) {
 		hasher:  hasher,
 		begin:   begin,
 		current: startPosition,
+		workers: 1,
 	}, nil
 }
 
 // Put saves a new associated pair <key, value> into databases. Returns an error on failure.
+// After a failure the writer can not be used anymore, all further calls return the same error.
 func (w *writerImpl) Put(key, value []byte) error {
-	lenKey, lenValue := len(key), len(value)
+	hashFunc := w.hasher()
+	hashFunc.Write(key)
+
+	return w.putHashed(key, value, hashFunc.Sum32())
+}
+
+// PutReader is like Put, but copies exactly size bytes of the value from the given reader, the rest
+// of the reader is not read. If the reader has less bytes, the writer fails with ErrValueSize.
+func (w *writerImpl) PutReader(key []byte, value io.Reader, size uint32) error {
+	hashFunc := w.hasher()
+	hashFunc.Write(key)
+
+	return w.putRecord(key, size, hashFunc.Sum32(), func() error {
+		if _, err := io.CopyN(w.buffer, value, int64(size)); err == io.EOF {
+			return ErrValueSize
+		} else if err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+// readValue reads exactly size bytes of a value given to PutReader into memory,
+// returns ErrValueSize if the reader has less bytes
+func readValue(reader io.Reader, size uint32) ([]byte, error) {
+	buf := make([]byte, size)
+
+	if _, err := io.ReadFull(reader, buf); err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, ErrValueSize
+	} else if err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
 
-	if uint64(lenKey) > maxUint || uint64(lenValue) > maxUint {
+// putHashed is like Put, but takes already calculated hash of the key
+func (w *writerImpl) putHashed(key, value []byte, h uint32) error {
+	if uint64(len(value)) > maxUint {
 		return ErrOutOfMemory
 	}
 
-	if err := writePair(w.buffer, uint32(lenKey), uint32(lenValue)); err != nil {
+	return w.putRecord(key, uint32(len(value)), h, func() error {
+		_, err := w.buffer.Write(value)
 		return err
+	})
+}
+
+// putRecord writes a record with the given key, value of the given size written by writeValue, and
+// adds it to the hash tables. After a failure the writer can not be used anymore, because the buffer
+// could already hold a part of the record, so the error is returned by all further calls.
+// ErrDuplicateKey and ErrOutOfMemory are returned before anything is written, so they are not sticky.
+func (w *writerImpl) putRecord(key []byte, valSize uint32, h uint32, writeValue func() error) error {
+	if w.err != nil {
+		return w.err
+	}
+
+	err := w.writeRecord(key, valSize, h, writeValue)
+
+	if err != nil && err != ErrDuplicateKey && err != ErrOutOfMemory {
+		w.err = err
+	}
+
+	return err
+}
+
+// writeRecord writes a record and adds it to the hash tables
+func (w *writerImpl) writeRecord(key []byte, valSize uint32, h uint32, writeValue func() error) error {
+	lenKey, lenValue := len(key), int(valSize)
+
+	if uint64(lenKey) > maxUint {
+		return ErrOutOfMemory
+	}
+
+	var (
+		duplicate slotRef
+		found     bool
+		err       error
+	)
+
+	if w.duplicates != AllowDuplicates {
+		if duplicate, found, err = w.findKey(key, h); err != nil {
+			return err
+		}
+
+		if found && w.duplicates == RejectDuplicates {
+			return ErrDuplicateKey
+		}
 	}
 
-	if err := binary.Write(w.buffer, binary.LittleEndian, key); err != nil {
+	size, tableSize := int64(8+lenKey+lenValue), w.tableSize
+
+	if !found {
+		tableSize += 2 * slotSize
+	}
+
+	// The record and hash tables have to be addressable by uint32 positions
+	if w.current+size+tableSize >= maxUint {
+		return ErrOutOfMemory
+	}
+
+	if err := writePair(w.buffer, uint32(lenKey), valSize); err != nil {
 		return err
 	}
 
-	if err := binary.Write(w.buffer, binary.LittleEndian, value); err != nil {
+	if _, err := w.buffer.Write(key); err != nil {
 		return err
 	}
 
-	hashFunc := w.hasher()
-	hashFunc.Write(key)
-	h := hashFunc.Sum32()
+	if err := writeValue(); err != nil {
+		return err
+	}
+
+	if found {
+		err = w.replaceSlot(duplicate, uint32(w.current))
+	} else {
+		err = w.addSlot(key, h)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if w.index != nil {
+		if err := w.index.add(sortRecord{key: append([]byte(nil), key...), seq: uint64(w.current)}); err != nil {
+			return err
+		}
+	}
+
+	w.current += size
+	w.tableSize = tableSize
+	w.records++
+	w.bytes += size
+	w.progress.report(w.Stats)
+
+	return nil
+}
+
+// Stats returns the progress of building the database
+func (w *writerImpl) Stats() WriterStats {
+	return WriterStats{
+		Records: w.records,
+		Bytes:   w.bytes,
+		Offset:  w.current,
+		Limit:   maxUint,
+	}
+}
+
+// EstimatedSize returns the size of the database if it was closed now: records and hash tables.
+// Optional sections written after the hash tables (filter, fingerprints) are not counted.
+func (w *writerImpl) EstimatedSize() int64 {
+	return w.current + w.tableSize
+}
+
+// addSlot adds a slot of the record at the current position to the hash tables
+func (w *writerImpl) addSlot(key []byte, h uint32) error {
+	if w.duplicates != AllowDuplicates {
+		w.indexSlot(h)
+	}
 
 	table := w.tables[h%tableNum]
 	table = append(table, slot{h, uint32(w.current)})
 	w.tables[h%tableNum] = table
 
-	if err := w.addPos(8); err != nil {
-		return err
-	}
+	if w.filterBitsPerKey > 0 || w.withFingerprints {
+		kh := fnv64a(key)
 
-	if err := w.addPos(lenKey); err != nil {
-		return err
+		if w.filterBitsPerKey > 0 {
+			w.keyHashes = append(w.keyHashes, kh)
+		}
+
+		if w.withFingerprints {
+			w.fingerprints[h%tableNum] = append(w.fingerprints[h%tableNum], fingerprint(kh))
+		}
 	}
 
-	if err := w.addPos(lenValue); err != nil {
-		return err
+	w.inMemory++
+
+	if w.memoryLimit > 0 && w.inMemory*w.slotMemory() > w.memoryLimit {
+		return w.spillSlots()
 	}
 
 	return nil
 }
 
 // Close commits database, makes it possible for reading.
+// The header is written only if all records and hash tables were written successfully.
 func (w *writerImpl) Close() error {
-	w.buffer.Flush()
+	_, err := w.CloseWithSummary()
+	return err
+}
 
-	for _, table := range &w.tables {
-		n := uint32(len(table) << 1)
-		if n == 0 {
-			continue
+// CloseWithSummary is like Close, but also returns the summary of the committed database.
+// Temporary files are removed even if the writer has already failed.
+func (w *writerImpl) CloseWithSummary() (BuildSummary, error) {
+	if w.err != nil {
+		w.release()
+		return BuildSummary{}, w.err
+	}
+
+	err := w.commit()
+
+	if cerr := w.release(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		w.err = err
+		return BuildSummary{}, err
+	}
+
+	w.err = ErrWriterClosed
+	w.summary.WriterStats = w.Stats()
+
+	return w.summary, nil
+}
+
+// release removes temporary files of the spilled slots and of the index
+func (w *writerImpl) release() error {
+	var err error
+
+	if w.spill != nil {
+		err = w.spill.close()
+		w.spill = nil
+	}
+
+	w.keyIndex = nil
+
+	if w.index != nil {
+		if cerr := w.index.close(); err == nil {
+			err = cerr
 		}
 
-		slots := make(hashTable, n)
+		w.index = nil
+	}
 
-		for _, slot := range table {
-			k := (slot.hash >> 8) % n
+	return err
+}
 
-			// Linear probing
-			for slots[k].position != 0 {
-				k = (k + 1) % n
-			}
+// commit writes hash tables, optional sections and the header
+func (w *writerImpl) commit() error {
+	if err := w.buffer.Flush(); err != nil {
+		return err
+	}
 
-			slots[k].position = slot.position
-			slots[k].hash = slot.hash
+	var lengths [tableNum]uint32
+
+	for i, table := range &w.tables {
+		lengths[i] = uint32(len(table) << 1)
+	}
+
+	if w.spill != nil {
+		if err := w.spill.flush(); err != nil {
+			return err
 		}
 
-		for _, slot := range slots {
-			if err := writePair(w.writer, slot.hash, slot.position); err != nil {
-				return err
+		for i, chunks := range &w.spill.chunks {
+			for _, chunk := range chunks {
+				lengths[i] += chunk.count << 1
 			}
 		}
 	}
 
+	header := make([]byte, 0, tablesRefsSize)
+
+	var pos uint32
+
+	for _, n := range &lengths {
+		if n == 0 {
+			pos = 0
+		} else {
+			pos = uint32(w.current)
+		}
+
+		header = appendPair(header, pos, n)
+
+		if err := w.addPos(slotSize * int(n)); err != nil {
+			return err
+		}
+	}
+
+	if err := w.writeTables(); err != nil {
+		return err
+	}
+
+	extensions, err := w.extensions()
+	if err != nil {
+		return err
+	}
+
+	// the signature follows the trailer, so the trailer is written even if it is empty
+	if len(extensions) > 0 || w.signingKey != nil {
+		if err := writeSections(w.writer, extensions, trailerBinding(header, w.tail)); err != nil {
+			return err
+		}
+	}
+
 	offset, err := w.writer.Seek(0, io.SeekCurrent)
 
 	if err != nil {
@@ -129,33 +397,360 @@ func (w *writerImpl) Close() error {
 		return err
 	}
 
-	var pos uint32
+	if _, err := w.writer.Write(header); err != nil {
+		return err
+	}
 
-	for _, table := range &w.tables {
-		n := len(table) << 1
+	if _, err := w.writer.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
 
-		if n == 0 {
-			pos = 0
-		} else {
-			pos = uint32(w.current)
+	if w.signingKey != nil {
+		if offset, err = w.sign(offset); err != nil {
+			return err
 		}
+	}
+
+	w.summary.Size = offset
 
-		if err := writePair(w.writer, pos, uint32(n)); err != nil {
+	return nil
+}
+
+// encodedTable is a hash table ready to be written
+type encodedTable struct {
+	slots, fingerprints []byte
+	stats               TableStats
+}
+
+// tableResult is a result of building of a hash table
+type tableResult struct {
+	table encodedTable
+	err   error
+}
+
+// writeTables builds hash tables using w.workers goroutines and writes them in order.
+// Only a few tables are kept in memory at the same time.
+func (w *writerImpl) writeTables() error {
+	workers := w.workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	var (
+		indexes = make(chan int)
+		tokens  = make(chan struct{}, 2*workers)
+		done    = make(chan struct{})
+		results [tableNum]chan tableResult
+	)
+
+	defer close(done)
+
+	for i := range results {
+		results[i] = make(chan tableResult, 1)
+	}
+
+	// fingerprints are spilled while tables are built, so workers read slots from a snapshot of the spill
+	var spilled *spillSnapshot
+	if w.spill != nil {
+		spilled = w.spill.snapshot()
+	}
+
+	go func() {
+		defer close(indexes)
+
+		for i := 0; i < tableNum; i++ {
+			select {
+			case tokens <- struct{}{}:
+				indexes <- i
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for j := 0; j < workers; j++ {
+		go func() {
+			for i := range indexes {
+				table, err := w.buildTable(i, spilled)
+				results[i] <- tableResult{table, err}
+			}
+		}()
+	}
+
+	for i := range results {
+		result := <-results[i]
+		<-tokens
+
+		if result.err != nil {
+			return result.err
+		}
+
+		if _, err := w.writer.Write(result.table.slots); err != nil {
 			return err
 		}
 
-		if err := w.addPos(slotSize * n); err != nil {
+		w.tail = appendTail(w.tail, result.table.slots)
+
+		if err := w.addFingerprints(result.table.fingerprints); err != nil {
 			return err
 		}
+
+		w.summary.Tables[i] = result.table.stats
+
+		if result.table.stats.MaxProbe > w.summary.MaxProbe {
+			w.summary.MaxProbe = result.table.stats.MaxProbe
+		}
 	}
 
-	if _, err := w.writer.Seek(offset, io.SeekStart); err != nil {
+	return nil
+}
+
+// buildTable places slots of the i-th table and of its spilled chunks, if any, using linear probing
+// and releases the slot list
+func (w *writerImpl) buildTable(i int, spilled *spillSnapshot) (encodedTable, error) {
+	var (
+		table   = w.tables[i]
+		tableFp = w.fingerprints[i]
+		encoded encodedTable
+	)
+
+	if spilled != nil {
+		spilledTable, spilledFp, err := spilled.read(i)
+		if err != nil {
+			return encoded, err
+		}
+
+		table, tableFp = append(spilledTable, table...), append(spilledFp, tableFp...)
+	}
+
+	n := uint32(len(table) << 1)
+	slots := make(hashTable, n)
+
+	var fingerprints []uint32
+	if w.withFingerprints {
+		fingerprints = make([]uint32, n)
+	}
+
+	encoded.stats.Records, encoded.stats.Slots = len(table), int(n)
+
+	for j, slot := range table {
+		k := (slot.hash >> 8) % n
+		probe := 1
+
+		// Linear probing
+		for slots[k].position != 0 {
+			k = (k + 1) % n
+			probe++
+		}
+
+		if probe > encoded.stats.MaxProbe {
+			encoded.stats.MaxProbe = probe
+		}
+
+		slots[k].position = slot.position
+		slots[k].hash = slot.hash
+
+		if fingerprints != nil {
+			fingerprints[k] = tableFp[j]
+		}
+	}
+
+	w.tables[i], w.fingerprints[i] = nil, nil
+
+	encoded.slots = make([]byte, 0, n*slotSize)
+	for _, slot := range slots {
+		encoded.slots = appendPair(encoded.slots, slot.hash, slot.position)
+	}
+
+	if fingerprints != nil {
+		encoded.fingerprints = make([]byte, 0, n*4)
+		for _, fp := range fingerprints {
+			encoded.fingerprints = appendUint32(encoded.fingerprints, fp)
+		}
+	}
+
+	return encoded, nil
+}
+
+// slotMemory returns the number of bytes a slot with its key hash and fingerprint takes in memory
+func (w *writerImpl) slotMemory() int {
+	size := slotSize
+
+	if w.withFingerprints {
+		size += 4
+	}
+
+	if w.filterBitsPerKey > 0 {
+		size += 8
+	}
+
+	return size
+}
+
+// addFingerprints adds encoded fingerprints of a hash table to the fingerprint section.
+// Over the memory limit the section is moved to the temporary file.
+func (w *writerImpl) addFingerprints(data []byte) error {
+	w.fingerprintData = append(w.fingerprintData, data...)
+
+	if w.memoryLimit == 0 || len(w.fingerprintData) <= w.memoryLimit {
+		return nil
+	}
+
+	if err := w.openSpill(); err != nil {
+		return err
+	}
+
+	// nothing else is written to the temporary file on Close, so the spilled part is contiguous
+	if w.spilledFingerprints == 0 {
+		w.fingerprintOffset = w.spill.offset
+	}
+
+	if err := w.spill.append(w.fingerprintData); err != nil {
 		return err
 	}
 
+	w.spilledFingerprints += int64(len(w.fingerprintData))
+	w.fingerprintData = w.fingerprintData[:0]
+
+	return nil
+}
+
+// openSpill creates the temporary file if there is none
+func (w *writerImpl) openSpill() error {
+	if w.spill != nil {
+		return nil
+	}
+
+	spill, err := newSlotSpill(w.tempDir)
+	if err != nil {
+		return err
+	}
+
+	w.spill = spill
+
 	return nil
 }
 
+// spillSlots moves slot lists and key hashes kept in memory to the temporary file
+func (w *writerImpl) spillSlots() error {
+	if err := w.openSpill(); err != nil {
+		return err
+	}
+
+	for i, table := range &w.tables {
+		if len(table) == 0 {
+			continue
+		}
+
+		if err := w.spill.write(i, table, w.fingerprints[i]); err != nil {
+			return err
+		}
+
+		w.tables[i], w.fingerprints[i] = nil, nil
+	}
+
+	if len(w.keyHashes) > 0 {
+		if err := w.spill.writeHashes(w.keyHashes); err != nil {
+			return err
+		}
+
+		w.keyHashes = nil
+	}
+
+	w.inMemory = 0
+
+	return nil
+}
+
+// extensions returns optional sections that should be written after the hash tables
+func (w *writerImpl) extensions() ([]extension, error) {
+	var extensions []extension
+
+	if w.filterBitsPerKey > 0 {
+		filter, err := w.buildFilter()
+		if err != nil {
+			return nil, err
+		}
+
+		extensions = append(extensions, extension{
+			tag:  filterSection,
+			data: filter.encode(),
+		})
+	}
+
+	if w.withFingerprints {
+		ext := extension{
+			tag:  fingerprintSection,
+			data: w.fingerprintData,
+		}
+
+		if w.spilledFingerprints > 0 {
+			if err := w.spill.flush(); err != nil {
+				return nil, err
+			}
+
+			ext.spilled = io.NewSectionReader(w.spill.file, w.fingerprintOffset, w.spilledFingerprints)
+		}
+
+		extensions = append(extensions, ext)
+	}
+
+	if w.keyCodec != "" || w.valueCodec != "" {
+		extensions = append(extensions, extension{
+			tag:  codecSection,
+			data: encodeCodecs(w.keyCodec, w.valueCodec),
+		})
+	}
+
+	if w.encryption != nil {
+		extensions = append(extensions, extension{
+			tag:  encryptionSection,
+			data: w.encryption.section(),
+		})
+	}
+
+	if w.index != nil {
+		data, err := w.buildIndex()
+		if err != nil {
+			return nil, err
+		}
+
+		extensions = append(extensions, extension{
+			tag:  indexSection,
+			data: data,
+		})
+	}
+
+	return extensions, nil
+}
+
+// buildFilter builds the filter of keys from key hashes kept in memory and in the temporary file
+func (w *writerImpl) buildFilter() (*bloomFilter, error) {
+	keys := len(w.keyHashes)
+	if w.spill != nil {
+		keys += w.spill.hashCount()
+	}
+
+	filter := newBloomFilter(keys, w.filterBitsPerKey)
+
+	if w.spill != nil {
+		if err := w.spill.forEachHash(filter.add); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, h := range w.keyHashes {
+		filter.add(h)
+	}
+
+	return filter, nil
+}
+
+// setCodecs records names of codecs of keys and values
+func (w *writerImpl) setCodecs(key, value string) {
+	w.keyCodec, w.valueCodec = key, value
+}
+
 // addPos try to shift current position on len. Returns err when was attempt to create a database up to 4 gb
 func (w *writerImpl) addPos(offset int) error {
 	newPos := w.current + int64(offset)
@@ -175,3 +770,13 @@ func writePair(writer io.Writer, a, b uint32) error {
 
 	return binary.Write(writer, binary.LittleEndian, pairBuf)
 }
+
+// appendPair appends binary representation of two uint32 numbers to the given slice
+func appendPair(buf []byte, a, b uint32) []byte {
+	return appendUint32(appendUint32(buf, a), b)
+}
+
+// appendUint32 appends little endian representation of the given number to the given slice
+func appendUint32(buf []byte, a uint32) []byte {
+	return append(buf, byte(a), byte(a>>8), byte(a>>16), byte(a>>24))
+}
@@ -0,0 +1,107 @@
+package cdb
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+)
+
+var errInjected = errors.New("injected failure")
+
+// failingWriteSeeker fails writes when more than limit bytes are written and seeks when failSeek is set
+type failingWriteSeeker struct {
+	*os.File
+	limit    int
+	failSeek bool
+}
+
+func (f *failingWriteSeeker) Write(p []byte) (int, error) {
+	if len(p) > f.limit {
+		n, _ := f.File.Write(p[:f.limit])
+		f.limit = 0
+
+		return n, errInjected
+	}
+
+	f.limit -= len(p)
+
+	return f.File.Write(p)
+}
+
+func (f *failingWriteSeeker) Seek(offset int64, whence int) (int64, error) {
+	if f.failSeek {
+		return 0, errInjected
+	}
+
+	return f.File.Seek(offset, whence)
+}
+
+func (suite *CDBTestSuite) assertHeaderIsNotWritten() {
+	header := make([]byte, tablesRefsSize)
+	_, err := suite.cdbFile.ReadAt(header, 0)
+
+	if err == nil {
+		suite.True(bytes.Equal(header, make([]byte, tablesRefsSize)), "header must not be written")
+	}
+}
+
+func (suite *CDBTestSuite) TestStickyPutError() {
+	writer, err := suite.cdbHandle.GetWriter(&failingWriteSeeker{File: suite.cdbFile, limit: 4096})
+	suite.Require().Nil(err)
+
+	value := bytes.Repeat([]byte("v"), 1000)
+
+	for err == nil {
+		err = writer.Put([]byte("key"), value)
+	}
+
+	suite.Equal(errInjected, err)
+	suite.Equal(errInjected, writer.Put([]byte("key"), []byte("value")), "the error must be sticky")
+	suite.Equal(errInjected, writer.Close())
+	suite.assertHeaderIsNotWritten()
+}
+
+func (suite *CDBTestSuite) TestFlushErrorOnClose() {
+	writer, err := suite.cdbHandle.GetWriter(&failingWriteSeeker{File: suite.cdbFile, limit: 10})
+	suite.Require().Nil(err)
+
+	suite.Nil(writer.Put([]byte("key"), []byte("value")))
+	suite.Equal(errInjected, writer.Close())
+	suite.Equal(errInjected, writer.Close())
+	suite.Equal(errInjected, writer.Put([]byte("key"), []byte("value")))
+	suite.assertHeaderIsNotWritten()
+}
+
+func (suite *CDBTestSuite) TestSeekErrorOnClose() {
+	ws := &failingWriteSeeker{File: suite.cdbFile, limit: 1 << 20}
+	writer, err := suite.cdbHandle.GetWriter(ws)
+	suite.Require().Nil(err)
+
+	suite.Nil(writer.Put([]byte("key"), []byte("value")))
+
+	ws.failSeek = true
+	suite.Equal(errInjected, writer.Close())
+	suite.assertHeaderIsNotWritten()
+}
+
+func (suite *CDBTestSuite) TestPutAfterClose() {
+	writer := suite.getCDBWriter()
+	suite.Nil(writer.Close())
+
+	suite.Equal(ErrWriterClosed, writer.Put([]byte("key"), []byte("value")))
+	suite.Equal(ErrWriterClosed, writer.Close())
+
+	data, err := ioutil.ReadFile(suite.cdbFile.Name())
+	suite.Nil(err)
+	suite.Len(data, tablesRefsSize)
+}
+
+func (suite *CDBTestSuite) TestParallelWriterStickyError() {
+	writer, err := suite.cdbHandle.GetParallelWriter(suite.cdbFile, 2)
+	suite.Require().Nil(err)
+
+	suite.Equal(ErrValueSize, writer.PutReader([]byte("key"), bytes.NewReader([]byte("value")), 6))
+	suite.Equal(ErrValueSize, writer.Put([]byte("key"), []byte("value")))
+	suite.Equal(ErrValueSize, writer.Close())
+}